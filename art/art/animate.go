@@ -0,0 +1,136 @@
+package main
+
+import (
+	"art/animation"
+	"art/encode"
+	"encoding/json"
+	"html/template"
+	"net/http"
+	"strconv"
+)
+
+const (
+	defaultFPS = 5
+	maxFPS     = 60
+)
+
+type animationRequest struct {
+	// Text is either raw frames separated by Delimiter or an encoded
+	// animation, depending on the endpoint.
+	Text      string   `json:"text"`
+	Frames    []string `json:"frames,omitempty"`
+	Delimiter string   `json:"delimiter,omitempty"`
+	Delta     bool     `json:"delta,omitempty"`
+}
+
+type animationResponse struct {
+	Result string   `json:"result,omitempty"`
+	Frames []string `json:"frames"`
+}
+
+// registerAnimation adds the playback page and the JSON endpoints for
+// multi-frame art. Decoded animations may hold at most maxOutput bytes.
+func registerAnimation(mux *http.ServeMux, maxOutput int) {
+	tmpl := template.Must(template.New("animate.html").
+		Funcs(templateFuncs).
+		ParseFiles("web/templates/animate.html"))
+
+	mux.HandleFunc("/animate", func(w http.ResponseWriter, r *http.Request) {
+		data := map[string]interface{}{"FPS": defaultFPS, "Delimiter": animation.DefaultDelimiter}
+		if r.Method != http.MethodPost {
+			tmpl.Execute(w, data)
+			return
+		}
+
+		err := r.ParseForm()
+		if isTooLarge(err) {
+			http.Error(w, "Input too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+		if err != nil {
+			http.Error(w, "Failed to parse form", http.StatusBadRequest)
+			return
+		}
+
+		input := r.FormValue("inputText")
+		data["Input"] = input
+		if fps, err := strconv.Atoi(r.FormValue("fps")); err == nil && fps > 0 && fps <= maxFPS {
+			data["FPS"] = fps
+		}
+		if delimiter := r.FormValue("delimiter"); delimiter != "" {
+			data["Delimiter"] = delimiter
+		}
+
+		var frames []string
+		if r.FormValue("mode") == "encoded" {
+			frames, err = animation.DecodeLimit(input, maxOutput)
+			if err != nil {
+				data["Error"] = err.Error()
+				w.WriteHeader(formErrorStatus(err))
+				tmpl.Execute(w, data)
+				return
+			}
+		} else {
+			if err := encode.CheckLines(input); err != nil {
+				data["Error"] = err.Error()
+				w.WriteHeader(formErrorStatus(err))
+				tmpl.Execute(w, data)
+				return
+			}
+			frames = animation.Split(input, r.FormValue("delimiter"))
+			data["Encoded"] = animation.Encode(frames, r.FormValue("delta") != "")
+		}
+		data["Frames"] = frames
+		tmpl.Execute(w, data)
+	})
+
+	mux.HandleFunc("/api/animation/encode", func(w http.ResponseWriter, r *http.Request) {
+		req, ok := readAnimationRequest(w, r)
+		if !ok {
+			return
+		}
+		frames := req.Frames
+		if frames == nil {
+			frames = animation.Split(req.Text, req.Delimiter)
+		}
+		for _, frame := range frames {
+			if err := encode.CheckLines(frame); err != nil {
+				apiErr := toAPIError(err)
+				writeJSON(w, statusFor(apiErr), apiErrorResponse{Error: apiErr})
+				return
+			}
+		}
+		writeJSON(w, http.StatusOK, animationResponse{
+			Result: animation.Encode(frames, req.Delta),
+			Frames: frames,
+		})
+	})
+
+	mux.HandleFunc("/api/animation/decode", func(w http.ResponseWriter, r *http.Request) {
+		req, ok := readAnimationRequest(w, r)
+		if !ok {
+			return
+		}
+		frames, err := animation.DecodeLimit(req.Text, maxOutput)
+		if err != nil {
+			apiErr := toAPIError(err)
+			writeJSON(w, statusFor(apiErr), apiErrorResponse{Error: apiErr})
+			return
+		}
+		writeJSON(w, http.StatusOK, animationResponse{Frames: frames})
+	})
+}
+
+func readAnimationRequest(w http.ResponseWriter, r *http.Request) (animationRequest, bool) {
+	var req animationRequest
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeAPIError(w, http.StatusMethodNotAllowed, codeInvalidRequest, "only POST is supported")
+		return req, false
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeBodyError(w, err)
+		return req, false
+	}
+	return req, true
+}
@@ -0,0 +1,155 @@
+package animation
+
+import (
+	"art/decode"
+	"art/encode"
+	"errors"
+	"strings"
+)
+
+// Marker lines that start each frame of an encoded animation. Encoded art
+// escapes every literal "[" as "[[", so these lines can never be art.
+const (
+	FrameMarker = "[frame]"
+	DeltaMarker = "[frame delta]"
+	// unchangedLine stands for the same line of the previous frame.
+	unchangedLine = "[=]"
+)
+
+// DefaultDelimiter separates frames of raw, unencoded art.
+const DefaultDelimiter = FrameMarker
+
+// reasonNothingToRepeat is reported when a delta frame has no earlier line
+// to copy.
+const reasonNothingToRepeat = "unchanged line has no earlier frame line to repeat"
+
+var ErrNoFrames = errors.New("animation has no frames")
+
+// Split cuts raw art into frames at every line that equals delimiter.
+// DefaultDelimiter is used if delimiter is empty.
+func Split(raw, delimiter string) []string {
+	if delimiter == "" {
+		delimiter = DefaultDelimiter
+	}
+	var frames []string
+	var current []string
+	started := false
+	for _, line := range strings.Split(raw, "\n") {
+		if strings.TrimRight(line, "\r") == delimiter {
+			if started || len(current) > 0 {
+				frames = append(frames, strings.Join(current, "\n"))
+			}
+			current = nil
+			started = true
+			continue
+		}
+		current = append(current, line)
+	}
+	if started || len(current) > 0 {
+		frames = append(frames, strings.Join(current, "\n"))
+	}
+	return frames
+}
+
+// Encode encodes every frame with encode.EncodeArt. With delta set, every
+// frame after the first only spells out the lines that differ from the
+// previous frame.
+func Encode(frames []string, delta bool) string {
+	var out []string
+	var previous []string
+	for i, frame := range frames {
+		lines := strings.Split(frame, "\n")
+		if !delta || i == 0 {
+			out = append(out, FrameMarker, encode.EncodeArt(frame))
+		} else {
+			out = append(out, DeltaMarker)
+			for j, line := range lines {
+				if j < len(previous) && previous[j] == line {
+					out = append(out, unchangedLine)
+				} else {
+					out = append(out, encode.EncodeArt(line))
+				}
+			}
+		}
+		previous = lines
+	}
+	return strings.Join(out, "\n")
+}
+
+// Decode turns an encoded animation back into its frames. Text before the
+// first marker counts as a full frame, so plain encoded art decodes as a
+// single frame. Errors carry the line number within the whole animation.
+func Decode(encoded string) ([]string, error) {
+	return DecodeLimit(encoded, 0)
+}
+
+// DecodeLimit decodes like Decode but fails with decode.ErrOutputTooLarge
+// once the frames hold more than maxOutput bytes. A maxOutput of zero or
+// less means no limit.
+func DecodeLimit(encoded string, maxOutput int) ([]string, error) {
+	var frames []string
+	total := 0
+	var current, previous []string
+	started, isDelta := false, false
+
+	finish := func() {
+		if started || len(current) > 0 {
+			frames = append(frames, strings.Join(current, "\n"))
+			previous = current
+		}
+		current = nil
+	}
+
+	for i, line := range strings.Split(encoded, "\n") {
+		switch line {
+		case FrameMarker, DeltaMarker:
+			finish()
+			started, isDelta = true, line == DeltaMarker
+			continue
+		case unchangedLine:
+			if !isDelta {
+				break
+			}
+			idx := len(current)
+			if idx >= len(previous) {
+				return nil, &decode.SyntaxError{Line: i + 1, Column: 1, Snippet: line, Reason: reasonNothingToRepeat}
+			}
+			current = append(current, previous[idx])
+			total += len(previous[idx])
+			if maxOutput > 0 && total > maxOutput {
+				return nil, decode.ErrOutputTooLarge
+			}
+			continue
+		}
+
+		// A line only gets what the lines before it left over. Zero would
+		// mean no limit, so a full budget still leaves one byte, which the
+		// total check below then rejects.
+		limit := 0
+		if maxOutput > 0 {
+			limit = maxOutput - total
+			if limit < 1 {
+				limit = 1
+			}
+		}
+		decoded, err := decode.DecodeArtLimit(line, limit)
+		if err != nil {
+			var syntaxErr *decode.SyntaxError
+			if errors.As(err, &syntaxErr) {
+				syntaxErr.Line = i + 1
+			}
+			return nil, err
+		}
+		current = append(current, decoded)
+		total += len(decoded)
+		if maxOutput > 0 && total > maxOutput {
+			return nil, decode.ErrOutputTooLarge
+		}
+	}
+	finish()
+
+	if len(frames) == 0 {
+		return nil, ErrNoFrames
+	}
+	return frames, nil
+}
@@ -0,0 +1,344 @@
+package ansi
+
+import (
+	"fmt"
+	"html"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+const esc = '\x1b'
+
+// Style is the graphic rendition in effect for a character. FG and BG hold
+// the SGR color parameters, such as "31", "38;5;208" or "48;2;0;0;255", and
+// are empty for the terminal's default colors.
+type Style struct {
+	Bold      bool
+	Dim       bool
+	Italic    bool
+	Underline bool
+	Reverse   bool
+	FG        string
+	BG        string
+}
+
+// SGR returns the escape sequence that sets exactly this style, starting from
+// a reset so it does not depend on what came before.
+func (s Style) SGR() string {
+	params := []string{"0"}
+	for _, attr := range []struct {
+		on    bool
+		param string
+	}{
+		{s.Bold, "1"}, {s.Dim, "2"}, {s.Italic, "3"}, {s.Underline, "4"}, {s.Reverse, "7"},
+	} {
+		if attr.on {
+			params = append(params, attr.param)
+		}
+	}
+	if s.FG != "" {
+		params = append(params, s.FG)
+	}
+	if s.BG != "" {
+		params = append(params, s.BG)
+	}
+	return "\x1b[" + strings.Join(params, ";") + "m"
+}
+
+// apply updates the style with the parameters of one SGR sequence.
+func (s *Style) apply(params string) {
+	if params == "" {
+		*s = Style{}
+		return
+	}
+	p := strings.Split(params, ";")
+	for i := 0; i < len(p); i++ {
+		n, err := strconv.Atoi(p[i])
+		if err != nil {
+			continue
+		}
+		switch {
+		case n == 0:
+			*s = Style{}
+		case n == 1:
+			s.Bold = true
+		case n == 2:
+			s.Dim = true
+		case n == 3:
+			s.Italic = true
+		case n == 4:
+			s.Underline = true
+		case n == 7:
+			s.Reverse = true
+		case n == 22:
+			s.Bold, s.Dim = false, false
+		case n == 23:
+			s.Italic = false
+		case n == 24:
+			s.Underline = false
+		case n == 27:
+			s.Reverse = false
+		case n >= 30 && n <= 37, n >= 90 && n <= 97:
+			s.FG = p[i]
+		case n == 39:
+			s.FG = ""
+		case n >= 40 && n <= 47, n >= 100 && n <= 107:
+			s.BG = p[i]
+		case n == 49:
+			s.BG = ""
+		case n == 38 || n == 48:
+			color, used := extendedColor(p[i:])
+			if n == 38 {
+				s.FG = color
+			} else {
+				s.BG = color
+			}
+			i += used
+		}
+	}
+}
+
+// extendedColor reads a 256-color ("38;5;n") or true color ("38;2;r;g;b")
+// parameter list and returns it with the number of extra parameters used.
+func extendedColor(p []string) (string, int) {
+	switch {
+	case len(p) >= 3 && p[1] == "5":
+		return strings.Join(p[:3], ";"), 2
+	case len(p) >= 5 && p[1] == "2":
+		return strings.Join(p[:5], ";"), 4
+	}
+	return "", len(p) - 1
+}
+
+// Cell is one character of text together with its style. A Control cell
+// holds an escape sequence other than a color change, such as cursor
+// movement, or a lone ESC, and is written out unchanged.
+type Cell struct {
+	Text    string
+	Style   Style
+	Control bool
+}
+
+// Parse splits s into styled characters. SGR sequences update the style and
+// other escape sequences, such as cursor movement, are dropped. Newlines are
+// returned as cells of their own.
+func Parse(s string) []Cell {
+	return parse(s, false)
+}
+
+// parse is Parse, keeping escape sequences other than SGR as Control cells
+// when keepControls is set.
+func parse(s string, keepControls bool) []Cell {
+	var cells []Cell
+	var style Style
+	for i := 0; i < len(s); {
+		if s[i] == esc {
+			params, final, end := readCSI(s, i)
+			if final == 0 {
+				// Not a complete sequence: only the ESC itself is special
+				end = i + 1
+			}
+			if final == 'm' {
+				style.apply(params)
+			} else if keepControls {
+				cells = append(cells, Cell{Text: s[i:end], Control: true})
+			}
+			i = end
+			continue
+		}
+		_, size := utf8.DecodeRuneInString(s[i:])
+		cells = append(cells, Cell{Text: s[i : i+size], Style: style})
+		i += size
+	}
+	return cells
+}
+
+// readCSI reads the escape sequence starting at s[start] == ESC. It returns
+// its parameters and final byte for a CSI sequence ("ESC [ params final"),
+// and the index just past the sequence.
+func readCSI(s string, start int) (params string, final byte, end int) {
+	if start+1 >= len(s) || s[start+1] != '[' {
+		return "", 0, start + 1
+	}
+	for i := start + 2; i < len(s); i++ {
+		if s[i] >= 0x40 && s[i] <= 0x7e {
+			return s[start+2 : i], s[i], i + 1
+		}
+	}
+	return "", 0, len(s)
+}
+
+// SequenceLength returns the length of the CSI sequence starting at s[start],
+// or 0 if there is none.
+func SequenceLength(s string, start int) int {
+	if start+1 >= len(s) || s[start] != esc || s[start+1] != '[' {
+		return 0
+	}
+	_, final, end := readCSI(s, start)
+	if final == 0 {
+		return 0
+	}
+	return end - start
+}
+
+// HasEscapes reports whether s contains any escape sequence.
+func HasEscapes(s string) bool {
+	return strings.IndexByte(s, esc) >= 0
+}
+
+// Normalize rewrites the SGR sequences in s so that a single one appears
+// only where the style of visible text changes. Styled text ends with a
+// reset. Other escape sequences are kept where they are. Text without
+// escapes is returned unchanged.
+func Normalize(s string) string {
+	if !HasEscapes(s) {
+		return s
+	}
+	return Render(parse(s, true))
+}
+
+// Render writes cells back out as text, with an SGR sequence wherever the
+// style of visible text changes and a reset after styled text.
+func Render(cells []Cell) string {
+	var b strings.Builder
+	var current Style
+	for _, c := range cells {
+		if c.Text != "\n" && !c.Control && c.Style != current {
+			b.WriteString(c.Style.SGR())
+			current = c.Style
+		}
+		b.WriteString(c.Text)
+	}
+	if current != (Style{}) {
+		b.WriteString(Style{}.SGR())
+	}
+	return b.String()
+}
+
+// Strip removes all escape sequences from s.
+func Strip(s string) string {
+	if !HasEscapes(s) {
+		return s
+	}
+	var b strings.Builder
+	for _, c := range Parse(s) {
+		b.WriteString(c.Text)
+	}
+	return b.String()
+}
+
+// HTML renders s as escaped HTML, wrapping styled text in spans with inline
+// CSS. Newlines are kept so the result can go inside a <pre>.
+func HTML(s string) string {
+	var b strings.Builder
+	var current Style
+	open := false
+	for _, c := range Parse(s) {
+		if c.Style != current {
+			if open {
+				b.WriteString("</span>")
+				open = false
+			}
+			current = c.Style
+			if css := current.css(); css != "" {
+				b.WriteString(`<span style="` + css + `">`)
+				open = true
+			}
+		}
+		b.WriteString(html.EscapeString(c.Text))
+	}
+	if open {
+		b.WriteString("</span>")
+	}
+	return b.String()
+}
+
+// css returns the inline style for s.
+func (s Style) css() string {
+	fg, bg := cssColor(s.FG), cssColor(s.BG)
+	if s.Reverse {
+		fg, bg = bg, fg
+		if fg == "" {
+			fg = "#fff"
+		}
+		if bg == "" {
+			bg = "#333"
+		}
+	}
+	var rules []string
+	if fg != "" {
+		rules = append(rules, "color:"+fg)
+	}
+	if bg != "" {
+		rules = append(rules, "background-color:"+bg)
+	}
+	if s.Bold {
+		rules = append(rules, "font-weight:bold")
+	}
+	if s.Dim {
+		rules = append(rules, "opacity:0.6")
+	}
+	if s.Italic {
+		rules = append(rules, "font-style:italic")
+	}
+	if s.Underline {
+		rules = append(rules, "text-decoration:underline")
+	}
+	return strings.Join(rules, ";")
+}
+
+// basicColors are the xterm defaults for the 16 standard colors.
+var basicColors = [16]string{
+	"#000000", "#cd0000", "#00cd00", "#cdcd00", "#0000ee", "#cd00cd", "#00cdcd", "#e5e5e5",
+	"#7f7f7f", "#ff0000", "#00ff00", "#ffff00", "#5c5cff", "#ff00ff", "#00ffff", "#ffffff",
+}
+
+// cssColor converts SGR color parameters to a CSS color.
+func cssColor(param string) string {
+	if param == "" {
+		return ""
+	}
+	p := strings.Split(param, ";")
+	n, _ := strconv.Atoi(p[0])
+	switch {
+	case n >= 30 && n <= 37:
+		return basicColors[n-30]
+	case n >= 40 && n <= 47:
+		return basicColors[n-40]
+	case n >= 90 && n <= 97:
+		return basicColors[n-90+8]
+	case n >= 100 && n <= 107:
+		return basicColors[n-100+8]
+	case len(p) == 3:
+		idx, _ := strconv.Atoi(p[2])
+		return color256(idx)
+	case len(p) == 5:
+		r, _ := strconv.Atoi(p[2])
+		g, _ := strconv.Atoi(p[3])
+		b, _ := strconv.Atoi(p[4])
+		return fmt.Sprintf("#%02x%02x%02x", r&255, g&255, b&255)
+	}
+	return ""
+}
+
+// color256 converts an index of the xterm 256-color palette to CSS.
+func color256(idx int) string {
+	switch {
+	case idx < 0 || idx > 255:
+		return ""
+	case idx < 16:
+		return basicColors[idx]
+	case idx < 232:
+		idx -= 16
+		level := func(v int) int {
+			if v == 0 {
+				return 0
+			}
+			return 55 + v*40
+		}
+		return fmt.Sprintf("#%02x%02x%02x", level(idx/36), level(idx/6%6), level(idx%6))
+	}
+	gray := 8 + (idx-232)*10
+	return fmt.Sprintf("#%02x%02x%02x", gray, gray, gray)
+}
@@ -0,0 +1,297 @@
+package main
+
+import (
+	"art/ansi"
+	"art/decode"
+	"art/encode"
+	"art/transform"
+	"encoding/json"
+	"errors"
+	"net/http"
+)
+
+// apiRequest is the body accepted by the JSON endpoints. Either Text or
+// Items is set; Items turns the call into a batch.
+type apiRequest struct {
+	Text      *string  `json:"text,omitempty"`
+	Items     []string `json:"items,omitempty"`
+	MultiLine bool     `json:"multiLine,omitempty"`
+	// Render picks how ANSI colors in the result come back: "ansi" keeps
+	// the escape sequences, "html" turns them into spans, "plain" drops them.
+	Render string `json:"render,omitempty"`
+	// Transform is a chain of operations such as "mirror-h | trim". Encode
+	// runs it on the input, decode on the result.
+	Transform string `json:"transform,omitempty"`
+	// NormalizeColors merges ANSI color codes before encoding, see
+	// encode.EncodeArtNormalized. The result no longer decodes byte for byte.
+	NormalizeColors bool `json:"normalizeColors,omitempty"`
+
+	ops []transform.Op
+	// maxOutput is how many bytes the result of this item may still have.
+	maxOutput int
+}
+
+type apiError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	Line    int    `json:"line,omitempty"`
+	Column  int    `json:"column,omitempty"`
+	Snippet string `json:"snippet,omitempty"`
+	Reason  string `json:"reason,omitempty"`
+}
+
+type apiResult struct {
+	Result     string              `json:"result"`
+	Stats      *encode.Stats       `json:"stats,omitempty"`
+	Comparison []encode.Comparison `json:"comparison,omitempty"`
+	Error      *apiError           `json:"error,omitempty"`
+}
+
+type apiBatchResponse struct {
+	Results []apiResult `json:"results"`
+}
+
+type apiErrorResponse struct {
+	Error apiError `json:"error"`
+}
+
+// Error codes returned by the API.
+const (
+	codeInvalidRequest = "invalid_request"
+	codeMalformedInput = "malformed_input"
+	codeNotFound       = "not_found"
+	codeTooLarge       = "too_large"
+	codeInternal       = "internal_error"
+)
+
+// artProcessor turns one piece of art into its result.
+type artProcessor func(input string, req apiRequest) (apiResult, error)
+
+func encodeProcessor(input string, req apiRequest) (apiResult, error) {
+	input, err := transform.ApplyLimit(input, req.ops, req.maxOutput)
+	if err != nil {
+		return apiResult{}, err
+	}
+	if err := encode.CheckLines(input); err != nil {
+		return apiResult{}, err
+	}
+	encodeArt := encode.EncodeArtWithStats
+	if req.NormalizeColors {
+		encodeArt = encode.EncodeArtNormalized
+	}
+	result, stats := encodeArt(input)
+	return apiResult{Result: result, Stats: &stats}, nil
+}
+
+// compareProcessor encodes like encodeProcessor and adds the sizes of the
+// alternative formats.
+func compareProcessor(input string, req apiRequest) (apiResult, error) {
+	input, err := transform.ApplyLimit(input, req.ops, req.maxOutput)
+	if err != nil {
+		return apiResult{}, err
+	}
+	req.ops = nil
+	res, err := encodeProcessor(input, req)
+	if err != nil {
+		return res, err
+	}
+	res.Comparison = encode.Compare(input)
+	return res, nil
+}
+
+// decodeProcessor decodes without letting the result grow past req.maxOutput
+// bytes.
+func decodeProcessor(input string, req apiRequest) (apiResult, error) {
+	var result string
+	var err error
+	if req.MultiLine {
+		result, err = decode.DecodeMultiLineLimit(input, req.maxOutput)
+	} else {
+		result, err = decode.DecodeArtLimit(input, req.maxOutput)
+	}
+	if err == nil {
+		result, err = transform.ApplyLimit(result, req.ops, req.maxOutput)
+	}
+	return apiResult{Result: result}, err
+}
+
+// transformProcessor only runs the transform chain.
+func transformProcessor(input string, req apiRequest) (apiResult, error) {
+	result, err := transform.ApplyLimit(input, req.ops, req.maxOutput)
+	return apiResult{Result: result}, err
+}
+
+func registerAPI(mux *http.ServeMux, cfg serverConfig) {
+	mux.HandleFunc("/api/encode", apiHandler(encodeProcessor, cfg.MaxOutputBytes))
+	mux.HandleFunc("/api/decode", apiHandler(decodeProcessor, cfg.MaxOutputBytes))
+	mux.HandleFunc("/api/compare", apiHandler(compareProcessor, cfg.MaxOutputBytes))
+	mux.HandleFunc("/api/transform", apiHandler(transformProcessor, cfg.MaxOutputBytes))
+	mux.HandleFunc("/api/image", apiImageHandler)
+	mux.HandleFunc("/api/banner", apiBannerHandler)
+	mux.HandleFunc("/api/fonts", apiFontsHandler)
+}
+
+// apiHandler wraps a processor with JSON decoding, batching and error mapping.
+// The results of a request, all batch items together, may hold at most
+// maxOutput bytes.
+func apiHandler(process artProcessor, maxOutput int) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			writeAPIError(w, http.StatusMethodNotAllowed, codeInvalidRequest, "only POST is supported")
+			return
+		}
+
+		var req apiRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeBodyError(w, err)
+			return
+		}
+
+		render, ok := renderers[req.Render]
+		if !ok {
+			writeAPIError(w, http.StatusBadRequest, codeInvalidRequest, `render must be "ansi", "html" or "plain"`)
+			return
+		}
+		ops, err := transform.ParseOps(req.Transform)
+		if err != nil {
+			writeAPIError(w, http.StatusBadRequest, codeInvalidRequest, err.Error())
+			return
+		}
+		req.ops = ops
+		run := withOutputLimit(withRenderer(process, render), maxOutput)
+
+		switch {
+		case req.Text != nil && req.Items != nil:
+			writeAPIError(w, http.StatusBadRequest, codeInvalidRequest, `use either "text" or "items", not both`)
+
+		case req.Text != nil:
+			result, err := run(*req.Text, req)
+			if err != nil {
+				apiErr := toAPIError(err)
+				writeJSON(w, statusFor(apiErr), apiErrorResponse{Error: apiErr})
+				return
+			}
+			writeJSON(w, http.StatusOK, result)
+
+		case req.Items != nil:
+			resp := apiBatchResponse{Results: make([]apiResult, len(req.Items))}
+			for i, item := range req.Items {
+				result, err := run(item, req)
+				if err != nil {
+					apiErr := toAPIError(err)
+					resp.Results[i].Error = &apiErr
+					continue
+				}
+				resp.Results[i] = result
+			}
+			writeJSON(w, http.StatusOK, resp)
+
+		default:
+			writeAPIError(w, http.StatusBadRequest, codeInvalidRequest, `missing "text" or "items"`)
+		}
+	}
+}
+
+// renderers convert a result for the "render" request field.
+var renderers = map[string]func(string) string{
+	"":      func(s string) string { return s },
+	"ansi":  func(s string) string { return s },
+	"html":  ansi.HTML,
+	"plain": ansi.Strip,
+}
+
+// withRenderer applies render to the result of process.
+func withRenderer(process artProcessor, render func(string) string) artProcessor {
+	return func(input string, req apiRequest) (apiResult, error) {
+		res, err := process(input, req)
+		if err == nil {
+			res.Result = render(res.Result)
+		}
+		return res, err
+	}
+}
+
+// withOutputLimit shares a budget of maxOutput bytes between every call of
+// the returned processor. Each call may use what the ones before it left,
+// so a batch of items cannot add up to more than a single request could.
+func withOutputLimit(process artProcessor, maxOutput int) artProcessor {
+	remaining := maxOutput
+	return func(input string, req apiRequest) (apiResult, error) {
+		if remaining <= 0 {
+			// A limit of zero would mean no limit to the decoder.
+			return apiResult{}, decode.ErrOutputTooLarge
+		}
+		req.maxOutput = remaining
+		res, err := process(input, req)
+		if err != nil {
+			return res, err
+		}
+		if len(res.Result) > remaining {
+			return apiResult{}, decode.ErrOutputTooLarge
+		}
+		remaining -= len(res.Result)
+		return res, nil
+	}
+}
+
+// toAPIError separates malformed input from everything else.
+func toAPIError(err error) apiError {
+	var syntaxErr *decode.SyntaxError
+	if errors.As(err, &syntaxErr) {
+		return apiError{
+			Code:    codeMalformedInput,
+			Message: err.Error(),
+			Line:    syntaxErr.Line,
+			Column:  syntaxErr.Column,
+			Snippet: syntaxErr.Snippet,
+			Reason:  syntaxErr.Reason,
+		}
+	}
+	if errors.Is(err, decode.ErrMalformedInput) {
+		return apiError{Code: codeMalformedInput, Message: err.Error()}
+	}
+	if errors.Is(err, transform.ErrBadOp) {
+		return apiError{Code: codeInvalidRequest, Message: err.Error()}
+	}
+	if errors.Is(err, decode.ErrOutputTooLarge) || errors.Is(err, transform.ErrOutputTooLarge) || errors.Is(err, encode.ErrLineTooLong) {
+		return apiError{Code: codeTooLarge, Message: err.Error()}
+	}
+	return apiError{Code: codeInternal, Message: "processing error"}
+}
+
+func statusFor(e apiError) int {
+	switch e.Code {
+	case codeInternal:
+		return http.StatusInternalServerError
+	case codeTooLarge:
+		return http.StatusRequestEntityTooLarge
+	}
+	return http.StatusBadRequest
+}
+
+// writeBodyError reports a request body that could not be read as JSON.
+func writeBodyError(w http.ResponseWriter, err error) {
+	if isTooLarge(err) {
+		writeAPIError(w, http.StatusRequestEntityTooLarge, codeTooLarge, "request body is too large")
+		return
+	}
+	writeAPIError(w, http.StatusBadRequest, codeInvalidRequest, "invalid JSON body")
+}
+
+// isTooLarge reports whether err comes from a body cut off by
+// http.MaxBytesReader.
+func isTooLarge(err error) bool {
+	var maxBytesErr *http.MaxBytesError
+	return errors.As(err, &maxBytesErr)
+}
+
+func writeAPIError(w http.ResponseWriter, status int, code, message string) {
+	writeJSON(w, status, apiErrorResponse{Error: apiError{Code: code, Message: message}})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
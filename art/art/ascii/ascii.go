@@ -0,0 +1,134 @@
+package ascii
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"strings"
+	"unicode/utf8"
+)
+
+// DefaultRamp lists characters from lightest to darkest.
+const DefaultRamp = " .:-=+*#%@"
+
+const (
+	DefaultWidth = 80
+	MaxWidth     = 400
+	// MaxPixels keeps a small file that claims huge dimensions from being
+	// decoded into gigabytes of memory.
+	MaxPixels = 40_000_000
+)
+
+var (
+	ErrInvalidWidth  = fmt.Errorf("width must be between 1 and %d", MaxWidth)
+	ErrInvalidRamp   = errors.New("ramp needs at least two characters")
+	ErrImageTooLarge = fmt.Errorf("image must have at most %d pixels", MaxPixels)
+)
+
+// Options controls how an image is turned into text.
+type Options struct {
+	// Width is the number of characters per line, DefaultWidth if zero.
+	Width int
+	// Ramp maps brightness to characters, lightest first. DefaultRamp if empty.
+	Ramp string
+	// Invert swaps light and dark, for light text on a dark background.
+	Invert bool
+}
+
+// Convert decodes a PNG or JPEG image from r and renders it as ASCII art.
+// Images with more than MaxPixels pixels are rejected before decoding.
+func Convert(r io.Reader, opts Options) (string, error) {
+	// Keep the header DecodeConfig reads so Decode can start from the top.
+	var header bytes.Buffer
+	cfg, _, err := image.DecodeConfig(io.TeeReader(r, &header))
+	if err != nil {
+		return "", fmt.Errorf("decode image: %w", err)
+	}
+	if cfg.Width*cfg.Height > MaxPixels {
+		return "", ErrImageTooLarge
+	}
+	img, _, err := image.Decode(io.MultiReader(&header, r))
+	if err != nil {
+		return "", fmt.Errorf("decode image: %w", err)
+	}
+	return Render(img, opts)
+}
+
+// Render turns img into lines of text. Each character covers a cell twice as
+// tall as it is wide, since terminal and browser fonts are roughly that shape.
+func Render(img image.Image, opts Options) (string, error) {
+	if opts.Width == 0 {
+		opts.Width = DefaultWidth
+	}
+	if opts.Width < 0 || opts.Width > MaxWidth {
+		return "", ErrInvalidWidth
+	}
+	if opts.Ramp == "" {
+		opts.Ramp = DefaultRamp
+	}
+	ramp := []rune(opts.Ramp)
+	if len(ramp) < 2 || !utf8.ValidString(opts.Ramp) {
+		return "", ErrInvalidRamp
+	}
+
+	bounds := img.Bounds()
+	if bounds.Empty() {
+		return "", nil
+	}
+	width := opts.Width
+	if width > bounds.Dx() {
+		width = bounds.Dx()
+	}
+	cellW := float64(bounds.Dx()) / float64(width)
+	cellH := cellW * 2
+	height := int(float64(bounds.Dy())/cellH + 0.5)
+	if height < 1 {
+		height = 1
+	}
+	cellH = float64(bounds.Dy()) / float64(height)
+
+	lines := make([]string, height)
+	for row := 0; row < height; row++ {
+		var line strings.Builder
+		y0 := bounds.Min.Y + int(float64(row)*cellH)
+		y1 := bounds.Min.Y + int(float64(row+1)*cellH)
+		for col := 0; col < width; col++ {
+			x0 := bounds.Min.X + int(float64(col)*cellW)
+			x1 := bounds.Min.X + int(float64(col+1)*cellW)
+			// Brightness 0 is black, 1 is white. The ramp goes from light to
+			// dark, so dark pixels pick characters near its end.
+			darkness := 1 - brightness(img, x0, y0, x1, y1)
+			if opts.Invert {
+				darkness = 1 - darkness
+			}
+			line.WriteRune(ramp[int(darkness*float64(len(ramp)-1)+0.5)])
+		}
+		lines[row] = strings.TrimRight(line.String(), " ")
+	}
+	return strings.Join(lines, "\n"), nil
+}
+
+// brightness returns the average luminance of the pixels in [x0,x1)×[y0,y1)
+// between 0 and 1. Transparent pixels count as white.
+func brightness(img image.Image, x0, y0, x1, y1 int) float64 {
+	if x1 <= x0 {
+		x1 = x0 + 1
+	}
+	if y1 <= y0 {
+		y1 = y0 + 1
+	}
+	var sum float64
+	for y := y0; y < y1; y++ {
+		for x := x0; x < x1; x++ {
+			r, g, b, a := img.At(x, y).RGBA()
+			// Rec. 601 luma on premultiplied values, then blend onto white.
+			luma := (0.299*float64(r) + 0.587*float64(g) + 0.114*float64(b)) / 0xffff
+			sum += luma + (1 - float64(a)/0xffff)
+		}
+	}
+	return sum / float64((x1-x0)*(y1-y0))
+}
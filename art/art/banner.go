@@ -0,0 +1,82 @@
+package main
+
+import (
+	"art/banner"
+	"art/encode"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+)
+
+// maxBannerText keeps a single banner request from rendering a book.
+const maxBannerText = 1000
+
+type bannerRequest struct {
+	Text   string `json:"text"`
+	Font   string `json:"font,omitempty"`
+	Width  int    `json:"width,omitempty"`
+	Align  string `json:"align,omitempty"`
+	Encode bool   `json:"encode,omitempty"`
+}
+
+// drawBanner validates the request and draws the banner.
+func drawBanner(req bannerRequest) (string, error) {
+	if len(req.Text) > maxBannerText {
+		return "", errors.New("text is too long")
+	}
+	if req.Width < 0 {
+		return "", errors.New("width must not be negative")
+	}
+	return banner.Render(req.Text, banner.Options{Font: req.Font, Width: req.Width, Align: req.Align})
+}
+
+// bannerFromForm reads a bannerRequest from the web form.
+func bannerFromForm(r *http.Request) (bannerRequest, error) {
+	req := bannerRequest{
+		Text:   r.FormValue("bannerText"),
+		Font:   r.FormValue("font"),
+		Align:  r.FormValue("align"),
+		Encode: r.FormValue("encode") != "",
+	}
+	if width := r.FormValue("width"); width != "" {
+		var err error
+		req.Width, err = strconv.Atoi(width)
+		if err != nil {
+			return req, errors.New("width must be a number")
+		}
+	}
+	return req, nil
+}
+
+func apiBannerHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeAPIError(w, http.StatusMethodNotAllowed, codeInvalidRequest, "only POST is supported")
+		return
+	}
+	var req bannerRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeBodyError(w, err)
+		return
+	}
+	art, err := drawBanner(req)
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, codeInvalidRequest, err.Error())
+		return
+	}
+	if !req.Encode {
+		writeJSON(w, http.StatusOK, apiResult{Result: art})
+		return
+	}
+	if err := encode.CheckLines(art); err != nil {
+		writeAPIError(w, http.StatusRequestEntityTooLarge, codeTooLarge, err.Error())
+		return
+	}
+	encoded, stats := encode.EncodeArtWithStats(art)
+	writeJSON(w, http.StatusOK, apiResult{Result: encoded, Stats: &stats})
+}
+
+func apiFontsHandler(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string][]string{"fonts": banner.Fonts()})
+}
@@ -0,0 +1,279 @@
+package banner
+
+import (
+	"errors"
+	"strings"
+)
+
+// Alignments accepted by Options.Align.
+const (
+	AlignLeft   = "left"
+	AlignCenter = "center"
+	AlignRight  = "right"
+)
+
+var ErrInvalidAlign = errors.New("align must be left, center or right")
+
+// Options controls how text is rendered.
+type Options struct {
+	// Font is the name of a bundled font, DefaultFont if empty.
+	Font string
+	// Width wraps the banner so no line is wider. Zero means no limit.
+	Width int
+	// Align positions each wrapped line within Width, or within the widest
+	// line when there is no limit. Left if empty.
+	Align string
+}
+
+// Render draws text as a banner. Newlines in text start a new banner row and
+// words are wrapped onto new rows to stay within opts.Width.
+func Render(text string, opts Options) (string, error) {
+	switch opts.Align {
+	case "":
+		opts.Align = AlignLeft
+	case AlignLeft, AlignCenter, AlignRight:
+	default:
+		return "", ErrInvalidAlign
+	}
+	font, err := LoadFont(opts.Font)
+	if err != nil {
+		return "", err
+	}
+
+	var blocks [][]string
+	for _, line := range strings.Split(text, "\n") {
+		blocks = append(blocks, font.wrap(strings.Fields(line), opts.Width)...)
+	}
+
+	width := opts.Width
+	if width == 0 {
+		for _, block := range blocks {
+			if w := blockWidth(block); w > width {
+				width = w
+			}
+		}
+	}
+
+	var out []string
+	for _, block := range blocks {
+		pad := width - blockWidth(block)
+		switch {
+		case pad <= 0, opts.Align == AlignLeft:
+			pad = 0
+		case opts.Align == AlignCenter:
+			pad /= 2
+		}
+		for _, row := range block {
+			out = append(out, strings.TrimRight(strings.Repeat(" ", pad)+row, " "))
+		}
+	}
+	return strings.Join(out, "\n"), nil
+}
+
+// wrap renders words greedily, starting a new block whenever the next word
+// would make it wider than width. A word that does not fit on its own is
+// split between characters.
+func (f *Font) wrap(words []string, width int) [][]string {
+	if len(words) == 0 {
+		return [][]string{f.render("")}
+	}
+	if width <= 0 {
+		return [][]string{f.render(strings.Join(words, " "))}
+	}
+
+	var blocks [][]string
+	current := ""
+	for _, word := range words {
+		candidate := word
+		if current != "" {
+			candidate = current + " " + word
+		}
+		if blockWidth(f.render(candidate)) <= width {
+			current = candidate
+			continue
+		}
+		if current != "" {
+			blocks = append(blocks, f.render(current))
+		}
+		current = ""
+		for _, c := range word {
+			if current != "" && blockWidth(f.render(current+string(c))) > width {
+				blocks = append(blocks, f.render(current))
+				current = ""
+			}
+			current += string(c)
+		}
+	}
+	return append(blocks, f.render(current))
+}
+
+// render draws a single line of text. Characters the font does not have are
+// skipped.
+func (f *Font) render(text string) []string {
+	rows := make([][]rune, f.height)
+	prevWidth := 0
+	for _, c := range text {
+		char, ok := f.chars[c]
+		if !ok {
+			continue
+		}
+		curWidth := len(char[0])
+		amount := f.smushAmount(rows, char, prevWidth, curWidth)
+		for i := range rows {
+			rows[i] = f.addChar(rows[i], char[i], amount, prevWidth, curWidth)
+		}
+		prevWidth = curWidth
+	}
+
+	lines := make([]string, f.height)
+	for i, row := range rows {
+		lines[i] = strings.ReplaceAll(string(row), string(f.hardblank), " ")
+	}
+	return lines
+}
+
+// smushAmount returns how many columns char can overlap the rows drawn so
+// far, following FIGlet's rules for the font's layout.
+func (f *Font) smushAmount(rows, char [][]rune, prevWidth, curWidth int) int {
+	if f.layout&(layoutSmush|layoutKerning) == 0 || len(rows[0]) == 0 {
+		return 0
+	}
+	amount := curWidth
+	for i, row := range rows {
+		ch := char[i]
+		lineEnd := len(row) - 1
+		for lineEnd > 0 && row[lineEnd] == ' ' {
+			lineEnd--
+		}
+		charStart := 0
+		for charStart < len(ch) && ch[charStart] == ' ' {
+			charStart++
+		}
+
+		rowAmount := charStart + len(row) - 1 - lineEnd
+		left := row[lineEnd]
+		switch {
+		case left == ' ':
+			rowAmount++
+		case charStart < len(ch):
+			if _, ok := f.smush(left, ch[charStart], prevWidth, curWidth); ok {
+				rowAmount++
+			}
+		}
+		if rowAmount < amount {
+			amount = rowAmount
+		}
+	}
+	if amount > len(rows[0]) {
+		amount = len(rows[0])
+	}
+	return amount
+}
+
+// addChar appends char to row, merging the overlapping columns.
+func (f *Font) addChar(row, char []rune, amount, prevWidth, curWidth int) []rune {
+	start := len(row) - amount
+	for k := 0; k < amount && k < len(char); k++ {
+		left := row[start+k]
+		if merged, ok := f.smush(left, char[k], prevWidth, curWidth); ok {
+			row[start+k] = merged
+		} else if char[k] != ' ' {
+			row[start+k] = char[k]
+		}
+	}
+	if amount < len(char) {
+		row = append(row, char[amount:]...)
+	}
+	return row
+}
+
+// smush merges two overlapping characters, reporting false when the font's
+// rules do not allow it.
+func (f *Font) smush(left, right rune, prevWidth, curWidth int) (rune, bool) {
+	if left == ' ' {
+		return right, true
+	}
+	if right == ' ' {
+		return left, true
+	}
+	if prevWidth < 2 || curWidth < 2 || f.layout&layoutSmush == 0 {
+		return 0, false
+	}
+
+	rules := f.layout & 63
+	if rules == 0 {
+		// Universal smushing: the later character wins over the earlier one.
+		switch {
+		case left == f.hardblank:
+			return right, true
+		case right == f.hardblank:
+			return left, true
+		case f.rightToLeft:
+			return left, true
+		}
+		return right, true
+	}
+
+	if rules&smushHardblank != 0 && left == f.hardblank && right == f.hardblank {
+		return left, true
+	}
+	if left == f.hardblank || right == f.hardblank {
+		return 0, false
+	}
+	if rules&smushEqual != 0 && left == right {
+		return left, true
+	}
+	if rules&smushLowline != 0 {
+		if left == '_' && strings.ContainsRune(`|/\[]{}()<>`, right) {
+			return right, true
+		}
+		if right == '_' && strings.ContainsRune(`|/\[]{}()<>`, left) {
+			return left, true
+		}
+	}
+	if rules&smushHierarchy != 0 {
+		classes := []string{"|", `/\`, "[]", "{}", "()", "<>"}
+		l, r := -1, -1
+		for i, class := range classes {
+			if strings.ContainsRune(class, left) {
+				l = i
+			}
+			if strings.ContainsRune(class, right) {
+				r = i
+			}
+		}
+		if l >= 0 && r >= 0 && l != r {
+			if l > r {
+				return left, true
+			}
+			return right, true
+		}
+	}
+	if rules&smushPair != 0 {
+		switch string([]rune{left, right}) {
+		case "[]", "][", "{}", "}{", "()", ")(":
+			return '|', true
+		}
+	}
+	if rules&smushBigX != 0 {
+		switch string([]rune{left, right}) {
+		case `/\`:
+			return '|', true
+		case `\/`:
+			return 'Y', true
+		case "><":
+			return 'X', true
+		}
+	}
+	return 0, false
+}
+
+func blockWidth(block []string) int {
+	width := 0
+	for _, row := range block {
+		if w := len([]rune(strings.TrimRight(row, " "))); w > width {
+			width = w
+		}
+	}
+	return width
+}
@@ -0,0 +1,191 @@
+package banner
+
+import (
+	"bufio"
+	"embed"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+//go:embed fonts/*.flf
+var fontFiles embed.FS
+
+// DefaultFont is used when no font is given.
+const DefaultFont = "standard"
+
+var ErrUnknownFont = errors.New("unknown font")
+
+// Horizontal layout bits of a FIGlet font, see the FIGfont 2 specification.
+const (
+	smushEqual     = 1
+	smushLowline   = 2
+	smushHierarchy = 4
+	smushPair      = 8
+	smushBigX      = 16
+	smushHardblank = 32
+	layoutKerning  = 64
+	layoutSmush    = 128
+)
+
+// Font is a parsed FIGlet (.flf) font.
+type Font struct {
+	hardblank   rune
+	height      int
+	layout      int
+	rightToLeft bool
+	chars       map[rune][][]rune
+}
+
+var (
+	fontCache   = map[string]*Font{}
+	fontCacheMu sync.Mutex
+)
+
+// Fonts lists the names of the bundled fonts.
+func Fonts() []string {
+	entries, _ := fontFiles.ReadDir("fonts")
+	var names []string
+	for _, e := range entries {
+		names = append(names, strings.TrimSuffix(e.Name(), ".flf"))
+	}
+	sort.Strings(names)
+	return names
+}
+
+// LoadFont returns the bundled font with the given name.
+func LoadFont(name string) (*Font, error) {
+	if name == "" {
+		name = DefaultFont
+	}
+	fontCacheMu.Lock()
+	defer fontCacheMu.Unlock()
+	if f, ok := fontCache[name]; ok {
+		return f, nil
+	}
+
+	file, err := fontFiles.Open(path.Join("fonts", path.Base(name)+".flf"))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownFont, name)
+	}
+	defer file.Close()
+	f, err := ParseFont(file)
+	if err != nil {
+		return nil, fmt.Errorf("font %q: %w", name, err)
+	}
+	fontCache[name] = f
+	return f, nil
+}
+
+// germanChars follow the printable ASCII characters in every FIGlet font.
+var germanChars = []rune{'Ä', 'Ö', 'Ü', 'ä', 'ö', 'ü', 'ß'}
+
+// ParseFont reads a font in FIGlet's flf2a format.
+func ParseFont(r io.Reader) (*Font, error) {
+	scanner := bufio.NewScanner(r)
+	if !scanner.Scan() {
+		return nil, errors.New("empty font file")
+	}
+	header := strings.Fields(scanner.Text())
+	if len(header) < 6 || !strings.HasPrefix(header[0], "flf2a") || len(header[0]) < 6 {
+		return nil, errors.New("not a FIGlet font")
+	}
+	nums := make([]int, len(header)-1)
+	for i, field := range header[1:] {
+		n, err := strconv.Atoi(field)
+		if err != nil {
+			return nil, fmt.Errorf("bad header field %q", field)
+		}
+		nums[i] = n
+	}
+
+	f := &Font{
+		hardblank: []rune(header[0])[5],
+		height:    nums[0],
+		chars:     map[rune][][]rune{},
+	}
+	if f.height < 1 {
+		return nil, errors.New("bad font height")
+	}
+	oldLayout, commentLines := nums[3], nums[4]
+	if len(nums) > 5 {
+		f.rightToLeft = nums[5] == 1
+	}
+	switch {
+	case len(nums) > 6:
+		f.layout = nums[6]
+	case oldLayout < 0:
+		f.layout = 0
+	case oldLayout == 0:
+		f.layout = layoutKerning
+	default:
+		f.layout = oldLayout&31 | layoutSmush
+	}
+
+	for i := 0; i < commentLines; i++ {
+		scanner.Scan()
+	}
+
+	readChar := func() ([][]rune, bool) {
+		rows := make([][]rune, f.height)
+		for i := range rows {
+			if !scanner.Scan() {
+				return nil, false
+			}
+			rows[i] = []rune(trimEndmark(scanner.Text()))
+		}
+		return rows, true
+	}
+
+	for c := rune(32); c < 127; c++ {
+		rows, ok := readChar()
+		if !ok {
+			return nil, fmt.Errorf("missing character %q", c)
+		}
+		f.chars[c] = rows
+	}
+	for _, c := range germanChars {
+		rows, ok := readChar()
+		if !ok {
+			return f, nil
+		}
+		f.chars[c] = rows
+	}
+	// Code-tagged characters: a line with the character code, then its rows.
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		code, err := strconv.ParseInt(fields[0], 0, 32)
+		if err != nil {
+			break
+		}
+		rows, ok := readChar()
+		if !ok {
+			break
+		}
+		if code >= 0 {
+			f.chars[rune(code)] = rows
+		}
+	}
+	return f, scanner.Err()
+}
+
+// trimEndmark strips the end marks, the repeated last character of each row.
+func trimEndmark(line string) string {
+	line = strings.TrimRight(line, " ")
+	if line == "" {
+		return line
+	}
+	mark := line[len(line)-1]
+	for len(line) > 0 && line[len(line)-1] == mark {
+		line = line[:len(line)-1]
+	}
+	return line
+}
@@ -0,0 +1,230 @@
+package main
+
+import (
+	"art/decode"
+	"art/encode"
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+)
+
+const cliUsage = `usage:
+  art                                                start the web server
+  art encode [-normalize-colors] [-i file] [-o file] encode art
+  art decode [-multi-line] [-i file] [-o file]       decode art
+
+Input defaults to stdin and output to stdout. Input and output must not be
+the same file. An output file is only replaced once the whole input has been
+processed.
+`
+
+// runCLI runs an encode or decode command and returns the process exit code.
+func runCLI(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	if len(args) == 0 {
+		fmt.Fprint(stderr, cliUsage)
+		return 2
+	}
+
+	command := args[0]
+	fs := flag.NewFlagSet("art "+command, flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	inPath := fs.String("i", "", "input file (default stdin)")
+	outPath := fs.String("o", "", "output file (default stdout)")
+	var multiLine, normalizeColors *bool
+	switch command {
+	case "encode":
+		normalizeColors = fs.Bool("normalize-colors", false, "merge ANSI color codes before encoding")
+	case "decode":
+		multiLine = fs.Bool("multi-line", false, "decode the input line by line")
+	case "-h", "-help", "--help", "help":
+		fmt.Fprint(stdout, cliUsage)
+		return 0
+	default:
+		fmt.Fprintf(stderr, "unknown command %q\n%s", command, cliUsage)
+		return 2
+	}
+	if err := fs.Parse(args[1:]); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		return 2
+	}
+	if fs.NArg() > 0 {
+		fmt.Fprintf(stderr, "unexpected argument %q\n", fs.Arg(0))
+		return 2
+	}
+
+	in := stdin
+	if *inPath != "" && *inPath != "-" {
+		f, err := os.Open(*inPath)
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			return 1
+		}
+		defer f.Close()
+		in = f
+	}
+
+	out := stdout
+	var outFile *os.File
+	if *outPath != "" && *outPath != "-" {
+		// Refuse to replace the input, which would lose the original.
+		if f, ok := in.(*os.File); ok && sameFile(f, *outPath) {
+			fmt.Fprintln(stderr, "input and output are the same file")
+			return 1
+		}
+		// Write next to the output and rename on success, so a failure
+		// leaves an existing output file untouched.
+		f, err := os.CreateTemp(filepath.Dir(*outPath), "."+filepath.Base(*outPath)+".*")
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			return 1
+		}
+		outFile = f
+		out = f
+	}
+
+	w := bufio.NewWriter(out)
+	var err error
+	switch {
+	case command == "encode" && *normalizeColors:
+		// Colors carry over from one line to the next, so normalizing
+		// needs the whole input.
+		err = encodeAll(in, w)
+	case command == "encode":
+		err = streamLines(in, w, encodeLine)
+	case *multiLine:
+		// Same result as decode.DecodeMultiLine, one line at a time so
+		// large files never have to fit in memory.
+		err = streamLines(in, w, decode.DecodeArt)
+	default:
+		err = decodeAll(in, w)
+	}
+	if flushErr := w.Flush(); err == nil {
+		err = flushErr
+	}
+	if outFile != nil {
+		err = finishOutput(outFile, *outPath, err)
+	}
+
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	return 0
+}
+
+// streamLines applies process to every line read from in and writes the
+// results to out, keeping the original line endings.
+func streamLines(in io.Reader, out io.Writer, process func(string) (string, error)) error {
+	r := bufio.NewReader(in)
+	for lineNo := 1; ; lineNo++ {
+		line, readErr := r.ReadString('\n')
+		if readErr != nil && readErr != io.EOF {
+			return readErr
+		}
+		if line == "" && readErr == io.EOF {
+			return nil
+		}
+
+		body := strings.TrimSuffix(line, "\n")
+		result, err := process(body)
+		if err != nil {
+			var syntaxErr *decode.SyntaxError
+			if errors.As(err, &syntaxErr) {
+				syntaxErr.Line = lineNo
+				return err
+			}
+			return fmt.Errorf("line %d: %w", lineNo, err)
+		}
+		if _, err := io.WriteString(out, result); err != nil {
+			return err
+		}
+		if len(body) < len(line) {
+			if _, err := io.WriteString(out, "\n"); err != nil {
+				return err
+			}
+		}
+		if readErr == io.EOF {
+			return nil
+		}
+	}
+}
+
+// sameFile reports whether f and the file at path are the same, for example
+// through a different path or a link.
+func sameFile(f *os.File, path string) bool {
+	inInfo, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	outInfo, err := os.Stat(path)
+	return err == nil && os.SameFile(inInfo, outInfo)
+}
+
+// finishOutput closes the temporary file f and, if err is nil, renames it to
+// path, keeping the mode of the file it replaces. On failure the temporary
+// file is removed.
+func finishOutput(f *os.File, path string, err error) error {
+	mode := os.FileMode(0o644)
+	if info, statErr := os.Stat(path); statErr == nil {
+		mode = info.Mode().Perm()
+	}
+	if err == nil {
+		err = f.Chmod(mode)
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), path)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+	}
+	return err
+}
+
+// encodeLine encodes one line the same way the server does.
+func encodeLine(line string) (string, error) {
+	if n := utf8.RuneCountInString(line); n > encode.MaxLineLength {
+		return "", fmt.Errorf("%d characters, at most %d are allowed: %w", n, encode.MaxLineLength, encode.ErrLineTooLong)
+	}
+	return encode.EncodeArt(line), nil
+}
+
+// encodeAll normalizes the colors of the whole input and encodes it the same
+// way the server does.
+func encodeAll(in io.Reader, out io.Writer) error {
+	data, err := io.ReadAll(in)
+	if err != nil {
+		return err
+	}
+	input := string(data)
+	if err := encode.CheckLines(input); err != nil {
+		return err
+	}
+	result, _ := encode.EncodeArtNormalized(input)
+	_, err = io.WriteString(out, result)
+	return err
+}
+
+// decodeAll decodes the whole input as a single piece of art.
+func decodeAll(in io.Reader, out io.Writer) error {
+	data, err := io.ReadAll(in)
+	if err != nil {
+		return err
+	}
+	result, err := decode.DecodeArt(string(data))
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(out, result)
+	return err
+}
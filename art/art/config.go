@@ -0,0 +1,92 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+)
+
+// serverConfig holds the settings of the web server. Every field can be
+// overridden with the environment variable named in loadConfig.
+type serverConfig struct {
+	Port            string
+	GalleryFile     string
+	MaxInputBytes   int64
+	MaxUploadBytes  int64
+	MaxOutputBytes  int
+	ReadTimeout     time.Duration
+	WriteTimeout    time.Duration
+	IdleTimeout     time.Duration
+	ShutdownTimeout time.Duration
+}
+
+func defaultConfig() serverConfig {
+	return serverConfig{
+		Port:            "8080",
+		GalleryFile:     galleryFile,
+		MaxInputBytes:   1 << 20,
+		MaxUploadBytes:  10 << 20,
+		MaxOutputBytes:  10 << 20,
+		ReadTimeout:     15 * time.Second,
+		WriteTimeout:    30 * time.Second,
+		IdleTimeout:     60 * time.Second,
+		ShutdownTimeout: 10 * time.Second,
+	}
+}
+
+// loadConfig starts from defaultConfig and applies the ART_* environment
+// variables that are set.
+func loadConfig() (serverConfig, error) {
+	cfg := defaultConfig()
+	if port := os.Getenv("ART_PORT"); port != "" {
+		cfg.Port = port
+	}
+	if path := os.Getenv("ART_GALLERY_FILE"); path != "" {
+		cfg.GalleryFile = path
+	}
+
+	sizes := []struct {
+		env string
+		dst *int64
+	}{
+		{"ART_MAX_INPUT_BYTES", &cfg.MaxInputBytes},
+		{"ART_MAX_UPLOAD_BYTES", &cfg.MaxUploadBytes},
+	}
+	for _, s := range sizes {
+		if v := os.Getenv(s.env); v != "" {
+			n, err := strconv.ParseInt(v, 10, 64)
+			if err != nil || n <= 0 {
+				return cfg, fmt.Errorf("%s must be a positive number of bytes", s.env)
+			}
+			*s.dst = n
+		}
+	}
+	if v := os.Getenv("ART_MAX_OUTPUT_BYTES"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			return cfg, fmt.Errorf("ART_MAX_OUTPUT_BYTES must be a positive number of bytes")
+		}
+		cfg.MaxOutputBytes = n
+	}
+
+	durations := []struct {
+		env string
+		dst *time.Duration
+	}{
+		{"ART_READ_TIMEOUT", &cfg.ReadTimeout},
+		{"ART_WRITE_TIMEOUT", &cfg.WriteTimeout},
+		{"ART_IDLE_TIMEOUT", &cfg.IdleTimeout},
+		{"ART_SHUTDOWN_TIMEOUT", &cfg.ShutdownTimeout},
+	}
+	for _, d := range durations {
+		if v := os.Getenv(d.env); v != "" {
+			t, err := time.ParseDuration(v)
+			if err != nil || t <= 0 {
+				return cfg, fmt.Errorf("%s must be a positive duration such as 30s", d.env)
+			}
+			*d.dst = t
+		}
+	}
+	return cfg, nil
+}
@@ -1,56 +1,213 @@
 package decode
 
 import (
+	"art/ansi"
 	"errors"
-	"regexp"
+	"fmt"
+	"math"
 	"strconv"
 	"strings"
+	"unicode/utf8"
 )
 
 var (
 	ErrMalformedInput = errors.New("malformed input")
+	ErrOutputTooLarge = errors.New("decoded output is too large")
 )
 
+// Reasons reported by SyntaxError.
+const (
+	ReasonMissingSpace = "missing space after count"
+	ReasonBadCount     = "count is not a number"
+	ReasonZeroCount    = "count must be greater than zero"
+	ReasonUnclosed     = "unclosed bracket"
+	ReasonEmptyToken   = "empty token"
+)
+
+// maxSnippet limits how much of the input a SyntaxError quotes.
+const maxSnippet = 20
+
+// SyntaxError describes where and why a "[count token]" block is malformed.
+// Line and Column are 1-based, Column counts characters rather than bytes.
+type SyntaxError struct {
+	Line    int
+	Column  int
+	Snippet string
+	Reason  string
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("line %d, column %d: %s near %q", e.Line, e.Column, e.Reason, e.Snippet)
+}
+
+// Unwrap lets callers keep matching on ErrMalformedInput.
+func (e *SyntaxError) Unwrap() error {
+	return ErrMalformedInput
+}
+
+// DecodeArt expands every "[count token]" block in encodedString. A doubled
+// "[[" stands for a literal "[", other text outside blocks is copied as-is.
+// Blocks may not span lines and their token ends at the first "]".
 func DecodeArt(encodedString string) (string, error) {
-	// Adjusted regex to match encoded sequences correctly.
-	correctPattern := regexp.MustCompile(`\[(\d+)\s([^]]+)]`)
-	encodingAttempt := regexp.MustCompile(`\[.*?]`)
+	return DecodeArtLimit(encodedString, 0)
+}
 
-	// Checking if the string contains unmatched or malformed encoding attempts
-	if encodingAttempt.MatchString(encodedString) && !correctPattern.MatchString(encodedString) {
-		return "", ErrMalformedInput
+// DecodeArtLimit decodes like DecodeArt but fails with ErrOutputTooLarge
+// before the result grows beyond maxOutput bytes. A maxOutput of zero or
+// less means no limit.
+func DecodeArtLimit(encodedString string, maxOutput int) (string, error) {
+	return decodeArt(encodedString, noLimit(maxOutput))
+}
+
+// noLimit turns a limit of zero or less into the largest possible one.
+func noLimit(maxOutput int) int {
+	if maxOutput <= 0 {
+		return math.MaxInt
 	}
+	return maxOutput
+}
 
-	decodedString := correctPattern.ReplaceAllStringFunc(encodedString, func(match string) string {
-		parts := correctPattern.FindStringSubmatch(match)
-		count, err := strconv.Atoi(parts[1])
-		if err != nil {
-			// This should never happen because the regex ensures that a number is matched.
-			return match
+func decodeArt(encodedString string, maxOutput int) (string, error) {
+	var result strings.Builder
+	line, lineStart := 1, 0
+
+	// Scanning bytes is safe for UTF-8: the syntax characters are all ASCII
+	// and never occur inside a multi-byte sequence, so tokens such as "█" or
+	// "═╗" are copied whole.
+	for i := 0; i < len(encodedString); {
+		c := encodedString[i]
+		if n := ansi.SequenceLength(encodedString, i); n > 0 {
+			// ANSI escape sequences start with "ESC [" but are not blocks.
+			result.WriteString(encodedString[i : i+n])
+			i += n
+			continue
+		}
+		if c != '[' {
+			if c == '\n' {
+				line++
+				lineStart = i + 1
+			}
+			result.WriteByte(c)
+			i++
+			continue
+		}
+		if i+1 < len(encodedString) && encodedString[i+1] == '[' {
+			result.WriteByte('[')
+			i += 2
+			continue
 		}
-		// Replicates the specified character or string 'count' times.
-		return strings.Repeat(parts[2], count)
-	})
 
-	// If the encoding attempt is present but the string remains unchanged, consider it malformed.
-	if encodingAttempt.MatchString(encodedString) && decodedString == encodedString {
-		return "", ErrMalformedInput
+		count, token, end, reason := parseBlock(encodedString, i)
+		if reason != "" {
+			return "", &SyntaxError{
+				Line:    line,
+				Column:  utf8.RuneCountInString(encodedString[lineStart:i]) + 1,
+				Snippet: snippet(encodedString, i),
+				Reason:  reason,
+			}
+		}
+		// Check before repeating so "[999999999 x]" never gets allocated.
+		if count > (maxOutput-result.Len())/len(token) {
+			return "", ErrOutputTooLarge
+		}
+		result.WriteString(strings.Repeat(token, count))
+		i = end
 	}
 
-	return decodedString, nil
+	if result.Len() > maxOutput {
+		return "", ErrOutputTooLarge
+	}
+	return result.String(), nil
+}
+
+// parseBlock parses the block starting at s[start] == '['. It returns the
+// count, the token and the index just past the closing bracket, or the
+// reason the block is malformed.
+func parseBlock(s string, start int) (count int, token string, end int, reason string) {
+	i := start + 1
+	for i < len(s) && s[i] >= '0' && s[i] <= '9' {
+		i++
+	}
+	digits := s[start+1 : i]
+
+	switch {
+	case digits == "" && (i == len(s) || s[i] == '\n'):
+		return 0, "", 0, ReasonUnclosed
+	case digits == "":
+		return 0, "", 0, ReasonBadCount
+	case i == len(s) || s[i] == '\n':
+		return 0, "", 0, ReasonUnclosed
+	case s[i] != ' ':
+		return 0, "", 0, ReasonMissingSpace
+	}
+
+	count, err := strconv.Atoi(digits)
+	if err != nil {
+		return 0, "", 0, ReasonBadCount
+	}
+	if count == 0 {
+		return 0, "", 0, ReasonZeroCount
+	}
+
+	tokenStart := i + 1
+	for i = tokenStart; i < len(s) && s[i] != ']'; i++ {
+		if s[i] == '\n' {
+			return 0, "", 0, ReasonUnclosed
+		}
+	}
+	if i == len(s) {
+		return 0, "", 0, ReasonUnclosed
+	}
+	if i == tokenStart {
+		return 0, "", 0, ReasonEmptyToken
+	}
+	return count, s[tokenStart:i], i + 1, ""
+}
+
+// snippet quotes the input from start up to the end of the block, the end of
+// the line or maxSnippet characters, whichever comes first.
+func snippet(s string, start int) string {
+	end := start
+	for n := 0; end < len(s) && n < maxSnippet && s[end] != '\n'; n++ {
+		_, size := utf8.DecodeRuneInString(s[end:])
+		end += size
+		if s[end-size] == ']' {
+			break
+		}
+	}
+	return s[start:end]
 }
 
 func DecodeMultiLine(encodedString string) (string, error) {
+	return DecodeMultiLineLimit(encodedString, 0)
+}
+
+// DecodeMultiLineLimit is DecodeMultiLine with the output limit of
+// DecodeArtLimit applied to the whole result.
+func DecodeMultiLineLimit(encodedString string, maxOutput int) (string, error) {
+	remaining := noLimit(maxOutput)
 	lines := strings.Split(encodedString, "\n")
 	var decodedLines []string
 
-	for _, line := range lines {
-		decodedLine, err := DecodeArt(line)
+	for i, line := range lines {
+		if i > 0 {
+			// The newline joining this line to the previous one.
+			remaining--
+		}
+		if remaining < 0 {
+			return "", ErrOutputTooLarge
+		}
+		decodedLine, err := decodeArt(line, remaining)
 		if err != nil {
+			var syntaxErr *SyntaxError
+			if errors.As(err, &syntaxErr) {
+				syntaxErr.Line = i + 1
+			}
 			// In case of any error, including malformed input, return immediately.
 			return "", err
 		}
 		decodedLines = append(decodedLines, decodedLine)
+		remaining -= len(decodedLine)
 	}
 
 	return strings.Join(decodedLines, "\n"), nil
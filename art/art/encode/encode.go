@@ -1,56 +1,242 @@
 package encode
 
 import (
+	"art/ansi"
+	"errors"
 	"fmt"
+	"strconv"
 	"strings"
+	"unicode"
+	"unicode/utf8"
 )
 
-// encodeLine encodes a single line using custom rules for specific patterns
-// and falls back to run-length encoding for general cases.
-func encodeLine(line string) string {
-	// Patterns to look for and their encoded representations
-	patternMap := map[string]string{
-		"/^--^\\     /^--^\\     /^--^\\":   "[22  ]/^--^\\     /^--^\\     /^--^\\",
-		"\\____/     \\____/     \\____/":   "[22  ]\\[4 _]/     \\[4 _]/     \\[4 _]/",
-		"/      \\   /      \\   /      \\": "[21  ]/[6  ]\\   /[6  ]\\   /[6  ]\\",
-		"|        | |        | |        |":  "[20  ]|[8  ]| |[8  ]| |[8  ]|",
-		"\\__  __/   \\__  __/   \\__  __/": "[21  ]\\__  __/   \\__  __/   \\__  __/",
-	}
-
-	// Attempt to match and replace patterns
-	for pattern, replacement := range patternMap {
-		if strings.Contains(line, pattern) {
-			return replacement
+// MaxLineLength is the longest line, in runes, that callers taking art from
+// users should pass to the encoder. CheckLines enforces it.
+const MaxLineLength = 10000
+
+// ErrLineTooLong is returned by CheckLines for a line over MaxLineLength.
+var ErrLineTooLong = errors.New("line is too long to encode")
+
+// CheckLines fails with ErrLineTooLong if any line of input has more than
+// MaxLineLength runes.
+func CheckLines(input string) error {
+	for i, line := range strings.Split(input, "\n") {
+		if n := utf8.RuneCountInString(line); n > MaxLineLength {
+			return fmt.Errorf("line %d has %d characters, at most %d are allowed: %w", i+1, n, MaxLineLength, ErrLineTooLong)
+		}
+	}
+	return nil
+}
+
+// zeroWidthJoiner glues emoji sequences such as 👩‍💻 into one character.
+const zeroWidthJoiner = '\u200d'
+
+// step is one piece of an encoded line: either a single literal character
+// (count == 0) or a block repeating token count times. size is the number
+// of characters the step covers.
+type step struct {
+	count int
+	token string
+	size  int
+}
+
+// blockSize returns the length of "[count token]" in bytes.
+func blockSize(count int, token string) int {
+	digits := 1
+	for ; count >= 10; count /= 10 {
+		digits++
+	}
+	return digits + len(token) + 3
+}
+
+// validToken reports whether token can appear inside a block without
+// confusing the decoder. A "]" would end the block early.
+func validToken(token string) bool {
+	return !strings.Contains(token, "]")
+}
+
+// loneEscape is an ESC that does not start a complete escape sequence.
+const loneEscape = "\x1b"
+
+// literalSize returns the encoded length of a single literal character. A
+// literal "[" is escaped as "[[" so it is never read as the start of a block.
+// A lone ESC is written as the block "[1 ESC]", since an ESC followed by the
+// "[" of a block or escape would decode as an escape sequence.
+func literalSize(char string) int {
+	switch {
+	case char == loneEscape:
+		return blockSize(1, char)
+	case char[0] == '[':
+		return len(char) + 1
+	}
+	return len(char)
+}
+
+// splitChars splits line into user-perceived characters: a rune together with
+// any combining marks that follow it, and emoji joined by zero width joiners.
+// ASCII always starts a new character, so syntax like "[" stays visible.
+// An ANSI escape sequence counts as a single character.
+// It returns the byte offset where each character starts, plus len(line).
+// Invalid UTF-8 bytes become characters of their own so nothing is lost.
+func splitChars(line string) []int {
+	offsets := []int{}
+	for i := 0; i < len(line); {
+		offsets = append(offsets, i)
+		if n := ansi.SequenceLength(line, i); n > 0 {
+			// A color change is copied whole and never split.
+			i += n
+			continue
+		}
+		prev, size := utf8.DecodeRuneInString(line[i:])
+		i += size
+		for i < len(line) {
+			r, size := utf8.DecodeRuneInString(line[i:])
+			joined := unicode.Is(unicode.M, r) || r == zeroWidthJoiner || prev == zeroWidthJoiner
+			if !joined || r < utf8.RuneSelf {
+				break
+			}
+			prev = r
+			i += size
+		}
+	}
+	return append(offsets, len(line))
+}
+
+// maxTokenChars caps how many characters a repeated token may have, and
+// maxRepeatChoices how many repeat counts are tried for each token, starting
+// from the most. Together they keep encodeLine linear in the line length.
+const (
+	maxTokenChars    = 32
+	maxRepeatChoices = 8
+)
+
+// encodeLine finds the shortest encoding of a single line. At every position
+// it considers emitting the character as-is or any repeated substring as a
+// "[count token]" block, and keeps whichever gives the shorter output. Tokens
+// always hold whole characters, so multi-byte glyphs like "█" are never split.
+// A maxToken above zero limits how many characters a token may have, it is
+// never more than maxTokenChars. It also returns how many blocks repeat a
+// single character (runs) and how many repeat a longer token (patterns).
+func encodeLine(line string, maxToken int) (encoded string, runs, patterns int) {
+	offsets := splitChars(line)
+	n := len(offsets) - 1
+	// chars returns characters [from, to) of the line.
+	chars := func(from, to int) string {
+		return line[offsets[from]:offsets[to]]
+	}
+	if maxToken <= 0 || maxToken > maxTokenChars {
+		maxToken = maxTokenChars
+	}
+
+	// best[i] is the shortest encoded length of the line from character i,
+	// choice[i] the step that achieves it.
+	best := make([]int, n+1)
+	choice := make([]step, n+1)
+	// repeats[size][i%size] is how many times the token of size characters
+	// at i repeats back to back. Walking backwards, the slot still holds the
+	// count for i+size when i is reached.
+	repeats := make([][]int, maxToken+1)
+	for size := 1; size <= maxToken; size++ {
+		repeats[size] = make([]int, size)
+	}
+
+	for i := n - 1; i >= 0; i-- {
+		best[i] = best[i+1] + literalSize(chars(i, i+1))
+		choice[i] = step{size: 1}
+
+		for size := 1; size <= maxToken; size++ {
+			count := &repeats[size][i%size]
+			if i+2*size > n || chars(i, i+size) != chars(i+size, i+2*size) {
+				*count = 1
+				continue
+			}
+			*count++
+
+			token := chars(i, i+size)
+			if !validToken(token) {
+				continue
+			}
+			for c := *count; c >= 2 && c > *count-maxRepeatChoices; c-- {
+				cost := blockSize(c, token) + best[i+c*size]
+				// On a tie prefer the step covering more characters, so
+				// "aaaaaaaaaa" becomes "[10 a]" rather than "a[9 a]".
+				if cost < best[i] || cost == best[i] && c*size > choice[i].size {
+					best[i] = cost
+					choice[i] = step{count: c, token: token, size: c * size}
+				}
+			}
 		}
 	}
 
-	// Fallback to run-length encoding for lines without special patterns
 	var result strings.Builder
-	count := 1
-	for i := 0; i < len(line); i++ {
-		if i+1 < len(line) && line[i] == line[i+1] {
-			count++
-		} else {
-			if count > 1 {
-				result.WriteString(fmt.Sprintf("[%d %s]", count, string(line[i])))
-				count = 1
-			} else {
-				result.WriteString(string(line[i]))
+	for i := 0; i < n; i += choice[i].size {
+		c := choice[i]
+		if c.count == 0 {
+			char := chars(i, i+1)
+			if char == loneEscape {
+				result.WriteString("[1 " + char + "]")
+				continue
+			}
+			if char[0] == '[' {
+				result.WriteByte('[')
 			}
+			result.WriteString(char)
+			continue
+		}
+		result.WriteString("[" + strconv.Itoa(c.count) + " " + c.token + "]")
+		if c.size == c.count {
+			runs++
+		} else {
+			patterns++
 		}
 	}
-	return result.String()
+	return result.String(), runs, patterns
 }
 
 // EncodeArt processes each line of the input ASCII art with encodeLine function.
 func EncodeArt(input string) string {
-	var result strings.Builder
-	lines := strings.Split(input, "\n")
+	encoded, _ := encodeLines(input, 0)
+	return encoded
+}
 
-	for _, line := range lines {
-		encodedLine := encodeLine(line)
-		result.WriteString(encodedLine + "\n")
-	}
+// EncodeArtWithStats encodes like EncodeArt and also reports how much the
+// encoding saved.
+func EncodeArtWithStats(input string) (string, Stats) {
+	return encodeLines(input, 0)
+}
 
-	return strings.TrimRight(result.String(), "\n")
+// EncodeArtNormalized rewrites ANSI colors with ansi.Normalize before
+// encoding, so a run of same-colored characters carries a single escape
+// sequence and can become a block. Unlike EncodeArt, the result does not
+// decode back byte for byte: redundant color codes are dropped.
+func EncodeArtNormalized(input string) (string, Stats) {
+	encoded, stats := encodeLines(ansi.Normalize(input), 0)
+	stats.OriginalSize = len(input)
+	stats.Ratio = ratio(stats.EncodedSize, stats.OriginalSize)
+	return encoded, stats
+}
+
+// EncodeRLE encodes runs of a single repeated character only, without looking
+// for longer repeated patterns.
+func EncodeRLE(input string) string {
+	encoded, _ := encodeLines(input, 1)
+	return encoded
+}
+
+// encodeLines encodes input line by line. Escape sequences are kept exactly
+// as they are, so the result decodes back to input.
+func encodeLines(input string, maxToken int) (string, Stats) {
+	var stats Stats
+	lines := strings.Split(input, "\n")
+	for i, line := range lines {
+		encoded, runs, patterns := encodeLine(line, maxToken)
+		lines[i] = encoded
+		stats.Runs += runs
+		stats.Patterns += patterns
+	}
+	encoded := strings.Join(lines, "\n")
+	stats.OriginalSize = len(input)
+	stats.EncodedSize = len(encoded)
+	stats.Ratio = ratio(stats.EncodedSize, stats.OriginalSize)
+	return encoded, stats
 }
@@ -0,0 +1,110 @@
+package encode
+
+import (
+	"art/decode"
+	"errors"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+// fragments are the pieces random art is built from. They cover the block
+// syntax, digits that could merge with a count, multi-byte and invalid UTF-8,
+// and complete, unfinished and lone escape sequences.
+var fragments = []string{
+	"[", "[[", "]", "[1 a]", " ", "0", "1", "7", "9",
+	"a", "b", "#", "\n",
+	"█", "═╗", "é", "é", "日本", "👩‍💻",
+	"\xff", "\xe2\x96", "\x80",
+	"\x1b", "\x1b[", "\x1b[31m", "\x1b[0m", "\x1b[1;32m", "\x1b[2J", "\x1b[10;5H",
+}
+
+// randomArt strings fragments together, often repeating one so the encoder
+// finds runs and patterns.
+func randomArt(rng *rand.Rand) string {
+	var b strings.Builder
+	for n := rng.Intn(12); n >= 0; n-- {
+		piece := fragments[rng.Intn(len(fragments))]
+		if rng.Intn(3) == 0 {
+			piece += fragments[rng.Intn(len(fragments))]
+		}
+		b.WriteString(strings.Repeat(piece, 1+rng.Intn(6)))
+	}
+	return b.String()
+}
+
+func TestRoundTrip(t *testing.T) {
+	cases := []string{
+		"",
+		"\x1b[2J",
+		"\x1b[0mplain",
+		"x\x1b[31m",
+		"\x1b[31m\x1b[31mred\x1b[0m",
+		"\x1b[[",
+		"\x1b[\nabc",
+		"\x1b[1 a]",
+		"[[[1 a]",
+		"111[[222",
+		"\xff\xff\xff\xfe",
+	}
+	rng := rand.New(rand.NewSource(1))
+	for i := 0; i < 5000; i++ {
+		cases = append(cases, randomArt(rng))
+	}
+
+	for _, input := range cases {
+		for name, encodeArt := range map[string]func(string) string{"EncodeArt": EncodeArt, "EncodeRLE": EncodeRLE} {
+			encoded := encodeArt(input)
+			decoded, err := decode.DecodeMultiLine(encoded)
+			if err != nil {
+				t.Fatalf("%s(%q) = %q, which fails to decode: %v", name, input, encoded, err)
+			}
+			if decoded != input {
+				t.Fatalf("%s(%q) = %q, which decodes to %q", name, input, encoded, decoded)
+			}
+		}
+	}
+}
+
+func TestEncodeMixedWidth(t *testing.T) {
+	tests := []struct {
+		name, input, want string
+	}{
+		{"CJK run", "日日日日日日", "[6 日]"},
+		{"CJK pattern", "日本日本日本日本", "[4 日本]"},
+		{"precomposed accent", "ééééé", "[5 é]"},
+		{"combining accent", "éééé", "[4 é]"},
+		{"stacked combining marks", "à́à́à́", "[3 à́]"},
+		{"combining mark before a run", "áaaaaaa", "á[6 a]"},
+		{"emoji", "🎉🎉🎉🎉🎉", "[5 🎉]"},
+		{"emoji joined by ZWJ", "👩‍💻👩‍💻👩‍💻👩‍💻", "[4 👩‍💻]"},
+		{"ZWJ emoji then plain emoji", "👩‍💻💻💻💻💻", "👩‍💻[4 💻]"},
+		{"blocks and CJK", "██日日██日日██日日", "[3 ██日日]"},
+		{"ASCII and CJK", "ab日ab日ab日", "[3 ab日]"},
+		{"ASCII and emoji", "==🎉==🎉==🎉x", "[3 ==🎉]x"},
+		{"mixed lines", "日日日日\n[ééé]\n🎉 🎉 🎉 ", "[4 日]\n[[[3 é]]\n[3 🎉 ]"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := EncodeArt(tt.input)
+			if got != tt.want {
+				t.Errorf("EncodeArt(%q) = %q, want %q", tt.input, got, tt.want)
+			}
+			decoded, err := decode.DecodeMultiLine(got)
+			if err != nil || decoded != tt.input {
+				t.Errorf("DecodeMultiLine(%q) = %q, %v, want %q", got, decoded, err, tt.input)
+			}
+		})
+	}
+}
+
+func TestCheckLines(t *testing.T) {
+	ok := strings.Repeat("█", MaxLineLength) + "\n" + strings.Repeat("x", MaxLineLength)
+	if err := CheckLines(ok); err != nil {
+		t.Errorf("CheckLines with lines of MaxLineLength runes: %v", err)
+	}
+	long := "short\n" + strings.Repeat("█", MaxLineLength+1)
+	if err := CheckLines(long); !errors.Is(err, ErrLineTooLong) {
+		t.Errorf("CheckLines with a line over MaxLineLength = %v, want ErrLineTooLong", err)
+	}
+}
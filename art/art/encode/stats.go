@@ -0,0 +1,75 @@
+package encode
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"math"
+)
+
+// Stats describes the result of an encoding. Sizes are in bytes and Ratio is
+// EncodedSize divided by OriginalSize, so anything below 1 saved space.
+type Stats struct {
+	OriginalSize int     `json:"originalSize"`
+	EncodedSize  int     `json:"encodedSize"`
+	Ratio        float64 `json:"ratio"`
+	Runs         int     `json:"runs"`
+	Patterns     int     `json:"patterns"`
+}
+
+// Formats compared by Compare.
+const (
+	FormatRLE        = "rle"
+	FormatPattern    = "pattern"
+	FormatGzipBase64 = "gzip+base64"
+)
+
+// Comparison is the output of one encoding format for the same input.
+type Comparison struct {
+	Format string  `json:"format"`
+	Output string  `json:"output"`
+	Size   int     `json:"size"`
+	Ratio  float64 `json:"ratio"`
+}
+
+// Compare encodes input with plain run-length encoding, the pattern-aware
+// encoder and gzip followed by base64, so the sizes can be put side by side.
+func Compare(input string) []Comparison {
+	outputs := []struct {
+		format string
+		output string
+	}{
+		{FormatRLE, EncodeRLE(input)},
+		{FormatPattern, EncodeArt(input)},
+		{FormatGzipBase64, gzipBase64(input)},
+	}
+
+	comparisons := make([]Comparison, len(outputs))
+	for i, o := range outputs {
+		comparisons[i] = Comparison{
+			Format: o.format,
+			Output: o.output,
+			Size:   len(o.output),
+			Ratio:  ratio(len(o.output), len(input)),
+		}
+	}
+	return comparisons
+}
+
+func gzipBase64(input string) string {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	// Writes to a bytes.Buffer cannot fail.
+	zw.Write([]byte(input))
+	zw.Close()
+	return base64.StdEncoding.EncodeToString(buf.Bytes())
+}
+
+// ratio returns encoded/original rounded to three decimals. Empty input has
+// nothing to compress, so its ratio is 1.
+func ratio(encoded, original int) float64 {
+	if original == 0 {
+		return 1
+	}
+	return math.Round(float64(encoded)/float64(original)*1000) / 1000
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"art/encode"
+	"art/gallery"
+	"encoding/json"
+	"errors"
+	"html/template"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// galleryFile is where saved art is kept unless ART_GALLERY_FILE says otherwise.
+const galleryFile = "gallery.json"
+
+type galleryRequest struct {
+	Title  string `json:"title"`
+	Author string `json:"author"`
+	Text   string `json:"text"`
+}
+
+// registerGallery adds the gallery page, the raw text download and the JSON
+// endpoints for saved art.
+func registerGallery(mux *http.ServeMux, store *gallery.Store) {
+	tmpl := template.Must(template.New("gallery.html").
+		Funcs(templateFuncs).
+		ParseFiles("web/templates/gallery.html"))
+
+	mux.HandleFunc("/gallery", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			query := r.URL.Query().Get("q")
+			tmpl.Execute(w, map[string]interface{}{
+				"Query":  query,
+				"Pieces": store.List(query),
+				"Saved":  r.URL.Query().Get("saved"),
+			})
+		case http.MethodPost:
+			piece, err := savePiece(store, galleryRequest{
+				Title:  r.FormValue("title"),
+				Author: r.FormValue("author"),
+				Text:   r.FormValue("raw"),
+			})
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			http.Redirect(w, r, "/gallery?saved="+url.QueryEscape(piece.ID)+"#"+piece.ID, http.StatusSeeOther)
+		default:
+			w.Header().Set("Allow", "GET, POST")
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+
+	mux.HandleFunc("GET /art/{file}", func(w http.ResponseWriter, r *http.Request) {
+		id, ok := strings.CutSuffix(r.PathValue("file"), ".txt")
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		piece, err := store.Get(id)
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Write([]byte(piece.Raw))
+	})
+
+	mux.HandleFunc("/api/gallery", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			pieces := store.List(r.URL.Query().Get("q"))
+			if pieces == nil {
+				pieces = []gallery.Piece{}
+			}
+			writeJSON(w, http.StatusOK, map[string][]gallery.Piece{"pieces": pieces})
+		case http.MethodPost:
+			var req galleryRequest
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				writeBodyError(w, err)
+				return
+			}
+			piece, err := savePiece(store, req)
+			if err != nil {
+				writeGalleryError(w, err)
+				return
+			}
+			writeJSON(w, http.StatusCreated, piece)
+		default:
+			w.Header().Set("Allow", "GET, POST")
+			writeAPIError(w, http.StatusMethodNotAllowed, codeInvalidRequest, "only GET and POST are supported")
+		}
+	})
+
+	mux.HandleFunc("GET /api/gallery/{id}", func(w http.ResponseWriter, r *http.Request) {
+		piece, err := store.Get(r.PathValue("id"))
+		if err != nil {
+			writeGalleryError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, piece)
+	})
+}
+
+// savePiece stores raw art along with its encoded form.
+func savePiece(store *gallery.Store, req galleryRequest) (gallery.Piece, error) {
+	if err := encode.CheckLines(req.Text); err != nil {
+		return gallery.Piece{}, err
+	}
+	return store.Save(gallery.Piece{
+		Title:   req.Title,
+		Author:  req.Author,
+		Raw:     req.Text,
+		Encoded: encode.EncodeArt(req.Text),
+	})
+}
+
+func writeGalleryError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, gallery.ErrNotFound):
+		writeAPIError(w, http.StatusNotFound, codeNotFound, err.Error())
+	case errors.Is(err, gallery.ErrEmptyArt), errors.Is(err, gallery.ErrFieldTooLong):
+		writeAPIError(w, http.StatusBadRequest, codeInvalidRequest, err.Error())
+	case errors.Is(err, encode.ErrLineTooLong):
+		writeAPIError(w, http.StatusRequestEntityTooLarge, codeTooLarge, err.Error())
+	default:
+		writeAPIError(w, http.StatusInternalServerError, codeInternal, "could not save art")
+	}
+}
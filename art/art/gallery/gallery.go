@@ -0,0 +1,169 @@
+package gallery
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	ErrNotFound     = errors.New("art not found")
+	ErrEmptyArt     = errors.New("art is empty")
+	ErrFieldTooLong = errors.New("title and author must be at most 100 characters")
+)
+
+// idAlphabet avoids look-alike characters so IDs are easy to share.
+const (
+	idAlphabet = "23456789abcdefghjkmnpqrstuvwxyzABCDEFGHJKLMNPQRSTUVWXYZ"
+	idLength   = 8
+	maxField   = 100
+)
+
+// Piece is one saved piece of art.
+type Piece struct {
+	ID        string    `json:"id"`
+	Title     string    `json:"title"`
+	Author    string    `json:"author"`
+	Raw       string    `json:"raw"`
+	Encoded   string    `json:"encoded"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// Store keeps pieces in memory and writes them to a JSON file on every change.
+type Store struct {
+	path   string
+	mu     sync.RWMutex
+	pieces map[string]Piece
+}
+
+// Open loads the store from path, starting empty if the file does not exist.
+func Open(path string) (*Store, error) {
+	s := &Store{path: path, pieces: map[string]Piece{}}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var pieces []Piece
+	if err := json.Unmarshal(data, &pieces); err != nil {
+		return nil, err
+	}
+	for _, p := range pieces {
+		s.pieces[p.ID] = p
+	}
+	return s, nil
+}
+
+// Save stores a new piece, filling in its ID and creation time.
+func (s *Store) Save(p Piece) (Piece, error) {
+	p.Title = strings.TrimSpace(p.Title)
+	p.Author = strings.TrimSpace(p.Author)
+	if strings.TrimSpace(p.Raw) == "" {
+		return Piece{}, ErrEmptyArt
+	}
+	if len([]rune(p.Title)) > maxField || len([]rune(p.Author)) > maxField {
+		return Piece{}, ErrFieldTooLong
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for {
+		id, err := newID()
+		if err != nil {
+			return Piece{}, err
+		}
+		if _, taken := s.pieces[id]; !taken {
+			p.ID = id
+			break
+		}
+	}
+	p.CreatedAt = time.Now().UTC()
+	s.pieces[p.ID] = p
+	if err := s.persist(); err != nil {
+		delete(s.pieces, p.ID)
+		return Piece{}, err
+	}
+	return p, nil
+}
+
+// Get returns the piece with the given ID.
+func (s *Store) Get(id string) (Piece, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	p, ok := s.pieces[id]
+	if !ok {
+		return Piece{}, ErrNotFound
+	}
+	return p, nil
+}
+
+// List returns the pieces whose title, author or art contains query, ignoring
+// case, newest first. An empty query matches everything.
+func (s *Store) List(query string) []Piece {
+	query = strings.ToLower(strings.TrimSpace(query))
+	s.mu.RLock()
+	var result []Piece
+	for _, p := range s.pieces {
+		if query == "" ||
+			strings.Contains(strings.ToLower(p.Title), query) ||
+			strings.Contains(strings.ToLower(p.Author), query) ||
+			strings.Contains(strings.ToLower(p.Raw), query) {
+			result = append(result, p)
+		}
+	}
+	s.mu.RUnlock()
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].CreatedAt.After(result[j].CreatedAt)
+	})
+	return result
+}
+
+// persist writes all pieces to a temporary file and renames it over the
+// store, so a crash never leaves a half-written file behind.
+func (s *Store) persist() error {
+	pieces := make([]Piece, 0, len(s.pieces))
+	for _, p := range s.pieces {
+		pieces = append(pieces, p)
+	}
+	sort.Slice(pieces, func(i, j int) bool {
+		return pieces[i].CreatedAt.Before(pieces[j].CreatedAt)
+	})
+	data, err := json.MarshalIndent(pieces, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if dir := filepath.Dir(s.path); dir != "." {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return err
+		}
+	}
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path)
+}
+
+func newID() (string, error) {
+	id := make([]byte, idLength)
+	max := big.NewInt(int64(len(idAlphabet)))
+	for i := range id {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		id[i] = idAlphabet[n.Int64()]
+	}
+	return string(id), nil
+}
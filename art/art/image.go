@@ -0,0 +1,104 @@
+package main
+
+import (
+	"art/ascii"
+	"art/encode"
+	"errors"
+	"html/template"
+	"net/http"
+	"strconv"
+)
+
+var errUploadTooLarge = errors.New("image is too large")
+
+// imageResult is what an image upload produces.
+type imageResult struct {
+	Art     string
+	Encoded string
+	Stats   *encode.Stats
+}
+
+// convertUpload reads the "image" file and conversion options from a
+// multipart form and turns the image into ASCII art, encoding it if the
+// "encode" field is set. The upload size is limited by limitBodies.
+func convertUpload(r *http.Request) (imageResult, error) {
+	// Keep up to 1 MB in memory, larger files go to a temporary file.
+	if err := r.ParseMultipartForm(1 << 20); err != nil {
+		if isTooLarge(err) {
+			return imageResult{}, errUploadTooLarge
+		}
+		return imageResult{}, errors.New("could not read upload")
+	}
+	file, _, err := r.FormFile("image")
+	if err != nil {
+		return imageResult{}, errors.New("missing image file")
+	}
+	defer file.Close()
+
+	opts := ascii.Options{
+		Ramp:   r.FormValue("ramp"),
+		Invert: r.FormValue("invert") != "",
+	}
+	if width := r.FormValue("width"); width != "" {
+		opts.Width, err = strconv.Atoi(width)
+		if err != nil {
+			return imageResult{}, ascii.ErrInvalidWidth
+		}
+	}
+
+	art, err := ascii.Convert(file, opts)
+	if err != nil {
+		return imageResult{}, err
+	}
+	result := imageResult{Art: art}
+	if r.FormValue("encode") != "" {
+		encoded, stats := encode.EncodeArtWithStats(art)
+		result.Encoded = encoded
+		result.Stats = &stats
+	}
+	return result, nil
+}
+
+// imageFormHandler handles uploads from the web form.
+func imageFormHandler(tmpl *template.Template) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Redirect(w, r, "/", http.StatusSeeOther)
+			return
+		}
+		result, err := convertUpload(r)
+		if err != nil {
+			w.WriteHeader(formErrorStatus(err))
+			tmpl.Execute(w, map[string]interface{}{"Error": err.Error()})
+			return
+		}
+		if result.Stats != nil {
+			tmpl.Execute(w, map[string]interface{}{"Result": result.Encoded, "Stats": *result.Stats, "Raw": result.Art})
+			return
+		}
+		tmpl.Execute(w, map[string]interface{}{"Result": result.Art, "Raw": result.Art})
+	}
+}
+
+// apiImageHandler is the JSON counterpart of imageFormHandler.
+func apiImageHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeAPIError(w, http.StatusMethodNotAllowed, codeInvalidRequest, "only POST is supported")
+		return
+	}
+	result, err := convertUpload(r)
+	if errors.Is(err, errUploadTooLarge) || errors.Is(err, ascii.ErrImageTooLarge) {
+		writeAPIError(w, http.StatusRequestEntityTooLarge, codeTooLarge, err.Error())
+		return
+	}
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, codeInvalidRequest, err.Error())
+		return
+	}
+	resp := apiResult{Result: result.Art, Stats: result.Stats}
+	if result.Stats != nil {
+		resp.Result = result.Encoded
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
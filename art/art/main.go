@@ -1,25 +1,124 @@
 package main
 
 import (
+	"art/ansi"
+	"art/ascii"
+	"art/banner"
 	"art/decode"
 	"art/encode"
+	"art/gallery"
+	"art/transform"
+	"context"
 	"errors"
 	"html/template"
 	"log"
 	"net/http"
-	"strings"
+	"os"
+	"os/signal"
+	"syscall"
 )
 
 func main() {
+	if len(os.Args) > 1 {
+		os.Exit(runCLI(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+	}
 	setupServer()
 }
 
+// templateFuncs are available to every page template.
+var templateFuncs = template.FuncMap{
+	"fonts":   banner.Fonts,
+	"colored": coloredHTML,
+}
+
+// coloredHTML renders text with ANSI colors as HTML spans.
+func coloredHTML(s string) template.HTML {
+	// ansi.HTML escapes the text and only emits styles it built itself.
+	return template.HTML(ansi.HTML(s))
+}
+
+// formErrorStatus picks the status code for an error shown on a web page.
+func formErrorStatus(err error) int {
+	if errors.Is(err, decode.ErrOutputTooLarge) || errors.Is(err, transform.ErrOutputTooLarge) || errors.Is(err, encode.ErrLineTooLong) || errors.Is(err, errUploadTooLarge) || errors.Is(err, ascii.ErrImageTooLarge) || isTooLarge(err) {
+		return http.StatusRequestEntityTooLarge
+	}
+	return http.StatusBadRequest
+}
+
+// limitBodies caps the size of every request body. Image uploads get their
+// own, larger limit.
+func limitBodies(cfg serverConfig, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		limit := cfg.MaxInputBytes
+		if r.URL.Path == "/image" || r.URL.Path == "/api/image" {
+			limit = cfg.MaxUploadBytes
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, limit)
+		next.ServeHTTP(w, r)
+	})
+}
+
 func setupServer() {
-	http.Handle("/static/", http.StripPrefix("/static/", http.FileServer(http.Dir("web/static"))))
-	tmpl := template.Must(template.ParseFiles("web/templates/index.html"))
-	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+	cfg, err := loadConfig()
+	if err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
+	store, err := gallery.Open(cfg.GalleryFile)
+	if err != nil {
+		log.Fatalf("Failed to open gallery: %v", err)
+	}
+
+	server := &http.Server{
+		Addr:              ":" + cfg.Port,
+		Handler:           limitBodies(cfg, newMux(cfg, store)),
+		ReadHeaderTimeout: cfg.ReadTimeout,
+		ReadTimeout:       cfg.ReadTimeout,
+		WriteTimeout:      cfg.WriteTimeout,
+		IdleTimeout:       cfg.IdleTimeout,
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	serveErr := make(chan error, 1)
+	go func() {
+		log.Printf("Server started on %s", server.Addr)
+		serveErr <- server.ListenAndServe()
+	}()
+
+	select {
+	case err := <-serveErr:
+		log.Fatalf("Server failed: %v", err)
+	case <-ctx.Done():
+	}
+
+	// Let requests in flight finish before exiting.
+	log.Println("Shutting down")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		log.Printf("Shutdown did not finish cleanly: %v", err)
+	}
+}
+
+// newMux registers every page and API endpoint.
+func newMux(cfg serverConfig, store *gallery.Store) *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.Handle("/static/", http.StripPrefix("/static/", http.FileServer(http.Dir("web/static"))))
+	tmpl := template.Must(template.New("index.html").
+		Funcs(templateFuncs).
+		ParseFiles("web/templates/index.html"))
+	registerAPI(mux, cfg)
+	registerGallery(mux, store)
+	registerAnimation(mux, cfg.MaxOutputBytes)
+	mux.HandleFunc("/image", imageFormHandler(tmpl))
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
 		if r.Method == http.MethodPost {
 			err := r.ParseForm()
+			if isTooLarge(err) {
+				http.Error(w, "Input too large", http.StatusRequestEntityTooLarge)
+				return
+			}
 			if err != nil {
 				http.Error(w, "Failed to parse form", http.StatusBadRequest)
 				return
@@ -30,28 +129,95 @@ func setupServer() {
 			var result string
 			var processErr error
 
+			spec := r.FormValue("transform")
+			ops, err := transform.ParseOps(spec)
+			if err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				tmpl.Execute(w, map[string]interface{}{"Error": err.Error(), "Input": inputText, "Transform": spec})
+				return
+			}
+
 			switch action {
 
-			case "encode":
-				result := encode.EncodeArt(inputText)
-				// Replace [n] with <br> for HTML display
-				result = strings.ReplaceAll(result, "[n]", "<br>")
+			case "encode", "transform":
+				transformed, err := transform.ApplyLimit(inputText, ops, cfg.MaxOutputBytes)
+				if err == nil && len(transformed) > cfg.MaxOutputBytes {
+					err = transform.ErrOutputTooLarge
+				}
+				if err != nil {
+					w.WriteHeader(formErrorStatus(err))
+					tmpl.Execute(w, map[string]interface{}{"Error": err.Error(), "Input": inputText, "Transform": spec})
+					return
+				}
+				if action == "transform" {
+					// Keep the transformed art in the text area for the next step
+					tmpl.Execute(w, map[string]interface{}{"Result": transformed, "Input": transformed, "Raw": transformed, "Transform": spec})
+					return
+				}
+				if err := encode.CheckLines(transformed); err != nil {
+					w.WriteHeader(formErrorStatus(err))
+					tmpl.Execute(w, map[string]interface{}{"Error": err.Error(), "Input": inputText, "Transform": spec})
+					return
+				}
+				inputText = transformed
+				encodeArt := encode.EncodeArtWithStats
+				if r.FormValue("normalizeColors") != "" {
+					encodeArt = encode.EncodeArtNormalized
+				}
+				result, stats := encodeArt(inputText)
 				// Directly render the template with the result for the "encode" action
-				tmpl.Execute(w, map[string]interface{}{"Result": result})
+				tmpl.Execute(w, map[string]interface{}{
+					"Result":     result,
+					"Stats":      stats,
+					"Comparison": encode.Compare(inputText),
+					"Raw":        inputText,
+					"Transform":  spec,
+				})
 				return
 
 			case "decode":
-				result, processErr = decode.DecodeArt(inputText)
+				result, processErr = decode.DecodeArtLimit(inputText, cfg.MaxOutputBytes)
+				if processErr == nil {
+					result, processErr = transform.ApplyLimit(result, ops, cfg.MaxOutputBytes)
+				}
+				if processErr == nil && len(result) > cfg.MaxOutputBytes {
+					processErr = decode.ErrOutputTooLarge
+				}
 				if processErr != nil {
-					if errors.Is(processErr, decode.ErrMalformedInput) {
-						http.Error(w, "Malformed input", http.StatusBadRequest)
+					if errors.Is(processErr, decode.ErrMalformedInput) || errors.Is(processErr, decode.ErrOutputTooLarge) || errors.Is(processErr, transform.ErrOutputTooLarge) || errors.Is(processErr, transform.ErrBadOp) {
+						// Show the position of the problem next to the input
+						w.WriteHeader(formErrorStatus(processErr))
+						tmpl.Execute(w, map[string]interface{}{"Error": processErr.Error(), "Input": inputText, "Transform": spec})
 					} else {
 						http.Error(w, "Processing error", http.StatusInternalServerError)
 					}
 					return
 				}
 				// For the "decode" action, render the template with the result as well
-				tmpl.Execute(w, map[string]interface{}{"Result": result})
+				tmpl.Execute(w, map[string]interface{}{"Result": result, "Raw": result, "Transform": spec})
+				return
+
+			case "banner":
+				req, err := bannerFromForm(r)
+				var art string
+				if err == nil {
+					art, err = drawBanner(req)
+				}
+				if err == nil && req.Encode {
+					err = encode.CheckLines(art)
+				}
+				if err != nil {
+					w.WriteHeader(formErrorStatus(err))
+					tmpl.Execute(w, map[string]interface{}{"Error": err.Error()})
+					return
+				}
+				if req.Encode {
+					encoded, stats := encode.EncodeArtWithStats(art)
+					tmpl.Execute(w, map[string]interface{}{"Result": encoded, "Stats": stats, "Raw": art})
+					return
+				}
+				// Put the banner in the text area so it can be encoded next
+				tmpl.Execute(w, map[string]interface{}{"Result": art, "Input": art, "Raw": art})
 				return
 
 			default:
@@ -64,6 +230,5 @@ func setupServer() {
 		}
 	})
 
-	log.Println("Server started on :8080")
-	http.ListenAndServe(":8080", nil)
+	return mux
 }
@@ -0,0 +1,426 @@
+package transform
+
+import (
+	"art/ansi"
+	"art/ascii"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+var (
+	ErrBadOp          = errors.New("invalid transform")
+	ErrOutputTooLarge = errors.New("transformed output is too large")
+)
+
+// MaxPadding is the most spaces pad may add on one side.
+const MaxPadding = 1000
+
+// Maps applied to characters so the drawing still looks right afterwards.
+var (
+	horizontalMirror = pairs(`/\`, "()", "[]", "{}", "<>")
+	verticalMirror   = pairs(`/\`, "^v", "',", "_‾")
+	// Turning a quarter clockwise: lines swap direction and arrows turn.
+	clockwise = map[string]string{
+		"-": "|", "|": "-", "_": "|", "/": `\`, `\`: "/",
+		"<": "^", "^": ">", ">": "v", "v": "<",
+	}
+	counterClockwise = reverse(clockwise)
+	invertRamp       = rampPairs(ascii.DefaultRamp)
+)
+
+// grid is text split into rows of styled characters.
+type grid [][]ansi.Cell
+
+// parse splits text into a grid. Combining marks stay with the character
+// before them.
+func parse(text string) grid {
+	rows := grid{nil}
+	for _, c := range ansi.Parse(text) {
+		last := len(rows) - 1
+		switch {
+		case c.Text == "\n":
+			rows = append(rows, nil)
+		case len(rows[last]) > 0 && isMark(c.Text):
+			rows[last][len(rows[last])-1].Text += c.Text
+		default:
+			rows[last] = append(rows[last], c)
+		}
+	}
+	return rows
+}
+
+func isMark(s string) bool {
+	for _, r := range s {
+		return unicode.Is(unicode.M, r) || r == '‍'
+	}
+	return false
+}
+
+func (g grid) String() string {
+	var cells []ansi.Cell
+	for i, row := range g {
+		if i > 0 {
+			cells = append(cells, ansi.Cell{Text: "\n"})
+		}
+		cells = append(cells, row...)
+	}
+	return ansi.Render(cells)
+}
+
+func (g grid) width() int {
+	w := 0
+	for _, row := range g {
+		if len(row) > w {
+			w = len(row)
+		}
+	}
+	return w
+}
+
+// cell returns the character at row y, column x, or a space past the end of
+// a short row.
+func (g grid) cell(x, y int) ansi.Cell {
+	if y < len(g) && x < len(g[y]) {
+		return g[y][x]
+	}
+	return ansi.Cell{Text: " "}
+}
+
+// MirrorHorizontal flips text left to right, so "/ )" becomes "( \".
+func MirrorHorizontal(text string) string {
+	g := parse(text)
+	w := g.width()
+	out := make(grid, len(g))
+	for y := range g {
+		for x := w - 1; x >= 0; x-- {
+			out[y] = append(out[y], mapped(g.cell(x, y), horizontalMirror))
+		}
+	}
+	return trim(out).String()
+}
+
+// MirrorVertical flips text upside down, so "/" becomes "\" and "^" becomes "v".
+func MirrorVertical(text string) string {
+	g := parse(text)
+	out := make(grid, len(g))
+	for y := range g {
+		for _, c := range g[len(g)-1-y] {
+			out[y] = append(out[y], mapped(c, verticalMirror))
+		}
+	}
+	return out.String()
+}
+
+// Rotate turns text clockwise by the given number of quarter turns, which may
+// be negative. Characters are not stretched, so rotated art looks squashed
+// or stretched by the font's aspect ratio.
+func Rotate(text string, quarterTurns int) string {
+	switch ((quarterTurns % 4) + 4) % 4 {
+	case 1:
+		return rotate(text, true)
+	case 2:
+		return MirrorVertical(MirrorHorizontal(text))
+	case 3:
+		return rotate(text, false)
+	}
+	return text
+}
+
+// rotate turns text a quarter clockwise or counterclockwise. Column x of the
+// text becomes row x, or row width-1-x when turning counterclockwise.
+func rotate(text string, cw bool) string {
+	g := parse(text)
+	w := g.width()
+	charMap := clockwise
+	if !cw {
+		charMap = counterClockwise
+	}
+	out := make(grid, w)
+	for x := 0; x < w; x++ {
+		row := x
+		if !cw {
+			row = w - 1 - x
+		}
+		for i := range g {
+			y := i
+			if cw {
+				y = len(g) - 1 - i
+			}
+			out[row] = append(out[row], mapped(g.cell(x, y), charMap))
+		}
+	}
+	return trim(out).String()
+}
+
+// Crop keeps width columns and height rows starting at column x and row y.
+// Parts of the area outside the text are left out.
+func Crop(text string, x, y, width, height int) (string, error) {
+	if x < 0 || y < 0 || width < 0 || height < 0 {
+		return "", fmt.Errorf("%w: crop values must not be negative", ErrBadOp)
+	}
+	g := parse(text)
+	var out grid
+	for row := y; row < y+height && row < len(g); row++ {
+		var cells []ansi.Cell
+		for col := x; col < x+width && col < len(g[row]); col++ {
+			cells = append(cells, g[row][col])
+		}
+		out = append(out, cells)
+	}
+	return out.String(), nil
+}
+
+// Pad surrounds text with spaces. Rows are first filled out to the same
+// width so the right padding lines up.
+func Pad(text string, top, right, bottom, left int) (string, error) {
+	if err := checkPadding(top, right, bottom, left); err != nil {
+		return "", err
+	}
+	g := parse(text)
+	w := g.width()
+	blank := make([]ansi.Cell, left+w+right)
+	for i := range blank {
+		blank[i] = ansi.Cell{Text: " "}
+	}
+
+	var out grid
+	for i := 0; i < top; i++ {
+		out = append(out, blank)
+	}
+	for y := range g {
+		row := append([]ansi.Cell{}, blank[:left]...)
+		for x := 0; x < w; x++ {
+			row = append(row, g.cell(x, y))
+		}
+		out = append(out, append(row, blank[:right]...))
+	}
+	for i := 0; i < bottom; i++ {
+		out = append(out, blank)
+	}
+	return out.String(), nil
+}
+
+func checkPadding(sides ...int) error {
+	for _, n := range sides {
+		if n < 0 {
+			return fmt.Errorf("%w: padding must not be negative", ErrBadOp)
+		}
+		if n > MaxPadding {
+			return fmt.Errorf("%w: padding must be at most %d", ErrBadOp, MaxPadding)
+		}
+	}
+	return nil
+}
+
+// Invert swaps light and dark characters of ascii.DefaultRamp, so "@" becomes
+// a space and "." becomes "%". Art made with another ramp is left as it is.
+func Invert(text string) string {
+	g := parse(text)
+	for y := range g {
+		for x := range g[y] {
+			g[y][x] = mapped(g[y][x], invertRamp)
+		}
+	}
+	return g.String()
+}
+
+// TrimTrailing removes trailing whitespace from every line and drops empty
+// lines at the end.
+func TrimTrailing(text string) string {
+	out := trim(parse(text))
+	for len(out) > 1 && len(out[len(out)-1]) == 0 {
+		out = out[:len(out)-1]
+	}
+	return out.String()
+}
+
+// trim removes unstyled trailing spaces from every row.
+func trim(g grid) grid {
+	for y, row := range g {
+		end := len(row)
+		for end > 0 && strings.TrimSpace(row[end-1].Text) == "" && row[end-1].Style == (ansi.Style{}) {
+			end--
+		}
+		g[y] = row[:end]
+	}
+	return g
+}
+
+func mapped(c ansi.Cell, m map[string]string) ansi.Cell {
+	if to, ok := m[c.Text]; ok {
+		c.Text = to
+	}
+	return c
+}
+
+// pairs builds a map that swaps the two characters of every pair.
+func pairs(list ...string) map[string]string {
+	m := map[string]string{}
+	for _, p := range list {
+		r := []rune(p)
+		m[string(r[0])] = string(r[1])
+		m[string(r[1])] = string(r[0])
+	}
+	return m
+}
+
+// rampPairs swaps every character of a ramp with the one at the same
+// distance from the other end.
+func rampPairs(ramp string) map[string]string {
+	r := []rune(ramp)
+	m := map[string]string{}
+	for i, c := range r {
+		m[string(c)] = string(r[len(r)-1-i])
+	}
+	return m
+}
+
+// reverse undoes a character map. "_" only wins where nothing else maps to
+// the same character.
+func reverse(m map[string]string) map[string]string {
+	out := map[string]string{}
+	for from, to := range m {
+		if _, taken := out[to]; !taken || from != "_" {
+			out[to] = from
+		}
+	}
+	return out
+}
+
+// Op is one step of a transform chain, such as "rotate:90".
+type Op struct {
+	Name string
+	Args []int
+}
+
+// ops lists the accepted operations with how many numbers each takes.
+var ops = map[string][]int{
+	"mirror-h": {0},
+	"mirror-v": {0},
+	"rotate":   {0, 1},
+	"crop":     {4},
+	"pad":      {1, 4},
+	"invert":   {0},
+	"trim":     {0},
+}
+
+// ParseOps reads a chain such as "mirror-h | rotate:90 | crop:0:0:20:10".
+// Operations are separated by "|" and their numbers by ":".
+func ParseOps(spec string) ([]Op, error) {
+	var chain []Op
+	for _, part := range strings.Split(spec, "|") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		fields := strings.Split(part, ":")
+		op := Op{Name: strings.ToLower(strings.TrimSpace(fields[0]))}
+		counts, ok := ops[op.Name]
+		if !ok {
+			return nil, fmt.Errorf("%w: unknown operation %q", ErrBadOp, op.Name)
+		}
+		for _, field := range fields[1:] {
+			n, err := strconv.Atoi(strings.TrimSpace(field))
+			if err != nil {
+				return nil, fmt.Errorf("%w: %q needs whole numbers", ErrBadOp, part)
+			}
+			op.Args = append(op.Args, n)
+		}
+		if !containsInt(counts, len(op.Args)) {
+			return nil, fmt.Errorf("%w: %q has the wrong number of values", ErrBadOp, part)
+		}
+		if op.Name == "pad" {
+			if err := checkPadding(op.Args...); err != nil {
+				return nil, err
+			}
+		}
+		chain = append(chain, op)
+	}
+	return chain, nil
+}
+
+// projectedCells returns how many characters op lays out for text. Only the
+// operations that fill out rows to the same width can grow the text; for the
+// rest it returns 0.
+func projectedCells(text string, op Op) int {
+	switch op.Name {
+	case "mirror-h", "rotate":
+		g := parse(text)
+		return len(g) * g.width()
+	case "pad":
+		a := op.Args
+		if len(a) == 1 {
+			a = []int{a[0], a[0], a[0], a[0]}
+		}
+		if checkPadding(a...) != nil {
+			// Pad reports the error.
+			return 0
+		}
+		g := parse(text)
+		return (a[0] + len(g) + a[2]) * (a[3] + g.width() + a[1])
+	}
+	return 0
+}
+
+func containsInt(list []int, n int) bool {
+	for _, v := range list {
+		if v == n {
+			return true
+		}
+	}
+	return false
+}
+
+// Apply runs the operations on text in order.
+func Apply(text string, chain []Op) (string, error) {
+	return ApplyLimit(text, chain, 0)
+}
+
+// ApplyLimit runs the operations like Apply but fails with ErrOutputTooLarge
+// before an operation builds a grid of more than maxOutput characters, which
+// the result would take at least as many bytes to hold. A maxOutput of zero
+// or less means no limit.
+func ApplyLimit(text string, chain []Op, maxOutput int) (string, error) {
+	var err error
+	for _, op := range chain {
+		if maxOutput > 0 && projectedCells(text, op) > maxOutput {
+			return "", ErrOutputTooLarge
+		}
+		switch op.Name {
+		case "mirror-h":
+			text = MirrorHorizontal(text)
+		case "mirror-v":
+			text = MirrorVertical(text)
+		case "rotate":
+			degrees := 90
+			if len(op.Args) == 1 {
+				degrees = op.Args[0]
+			}
+			if degrees%90 != 0 {
+				return "", fmt.Errorf("%w: rotate only turns by multiples of 90 degrees", ErrBadOp)
+			}
+			text = Rotate(text, degrees/90)
+		case "crop":
+			text, err = Crop(text, op.Args[0], op.Args[1], op.Args[2], op.Args[3])
+		case "pad":
+			a := op.Args
+			if len(a) == 1 {
+				a = []int{a[0], a[0], a[0], a[0]}
+			}
+			text, err = Pad(text, a[0], a[1], a[2], a[3])
+		case "invert":
+			text = Invert(text)
+		case "trim":
+			text = TrimTrailing(text)
+		default:
+			err = fmt.Errorf("%w: unknown operation %q", ErrBadOp, op.Name)
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+	return text, nil
+}
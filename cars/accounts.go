@@ -0,0 +1,352 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Account is a registered user and the cars they like.
+type Account struct {
+	Username     string    `json:"username"`
+	PasswordHash string    `json:"passwordHash"`
+	LikedCars    []int     `json:"likedCars"`
+	Created      time.Time `json:"created"`
+	// History holds the latest cars the user viewed, compared and liked,
+	// for recommendations.
+	History []interaction `json:"history,omitempty"`
+}
+
+// session ties a login cookie to an account.
+type session struct {
+	Username string    `json:"username"`
+	Expires  time.Time `json:"expires"`
+}
+
+// accountStore is what users.json holds. Accounts are keyed by lower case
+// username and sessions by the SHA-256 of their token, so the file never
+// contains a usable cookie.
+type accountStore struct {
+	Accounts map[string]*Account `json:"accounts"`
+	Sessions map[string]session  `json:"sessions"`
+}
+
+const (
+	defaultAccountsFile = "users.json"
+	sessionCookie       = "session"
+	sessionLifetime     = 30 * 24 * time.Hour
+	minPasswordLength   = 8
+	maxPasswordLength   = 256
+	maxAccountBody      = 4 << 10
+)
+
+// Password hashing with PBKDF2-HMAC-SHA256.
+const (
+	pbkdf2Iterations = 600_000
+	saltLength       = 16
+	hashLength       = 32
+)
+
+var (
+	accounts      = accountStore{Accounts: map[string]*Account{}, Sessions: map[string]session{}}
+	accountsMutex sync.Mutex
+	accountsFile  = defaultAccountsFile
+)
+
+var usernamePattern = regexp.MustCompile(`^[A-Za-z0-9_.-]{3,32}$`)
+
+// dummyHash is checked against when a username does not exist, so a login
+// takes as long whether or not the account is there.
+var dummyHash = hashPassword("not a real password")
+
+func loadAccounts() {
+	if f := os.Getenv("CARS_USERS_FILE"); f != "" {
+		accountsFile = f
+	}
+	content, err := os.ReadFile(accountsFile)
+	if errors.Is(err, os.ErrNotExist) {
+		return
+	}
+	if err == nil {
+		err = json.Unmarshal(content, &accounts)
+	}
+	if err != nil {
+		log.Fatalf("Error reading %s: %v", accountsFile, err)
+	}
+	if accounts.Accounts == nil {
+		accounts.Accounts = map[string]*Account{}
+	}
+	if accounts.Sessions == nil {
+		accounts.Sessions = map[string]session{}
+	}
+}
+
+// saveAccounts writes users.json. The caller must hold accountsMutex.
+func saveAccounts() error {
+	now := time.Now()
+	for key, s := range accounts.Sessions {
+		if now.After(s.Expires) {
+			delete(accounts.Sessions, key)
+		}
+	}
+	content, err := json.MarshalIndent(accounts, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := accountsFile + ".tmp"
+	if err := os.WriteFile(tmp, content, 0o600); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, accountsFile); err != nil {
+		return err
+	}
+	historyChanged = false
+	return nil
+}
+
+// hashPassword returns "pbkdf2-sha256$iterations$salt$hash" with a random
+// salt.
+func hashPassword(password string) string {
+	salt := make([]byte, saltLength)
+	if _, err := rand.Read(salt); err != nil {
+		panic(err)
+	}
+	key := pbkdf2SHA256([]byte(password), salt, pbkdf2Iterations, hashLength)
+	return fmt.Sprintf("pbkdf2-sha256$%d$%s$%s", pbkdf2Iterations,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key))
+}
+
+func checkPassword(password, encoded string) bool {
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 4 || parts[0] != "pbkdf2-sha256" {
+		return false
+	}
+	iterations, err := strconv.Atoi(parts[1])
+	if err != nil || iterations < 1 {
+		return false
+	}
+	salt, err1 := base64.RawStdEncoding.DecodeString(parts[2])
+	want, err2 := base64.RawStdEncoding.DecodeString(parts[3])
+	if err1 != nil || err2 != nil {
+		return false
+	}
+	got := pbkdf2SHA256([]byte(password), salt, iterations, len(want))
+	return subtle.ConstantTimeCompare(got, want) == 1
+}
+
+// pbkdf2SHA256 derives a key as described in RFC 8018.
+func pbkdf2SHA256(password, salt []byte, iterations, keyLen int) []byte {
+	mac := hmac.New(sha256.New, password)
+	var key []byte
+	for block := uint32(1); len(key) < keyLen; block++ {
+		mac.Reset()
+		mac.Write(salt)
+		binary.Write(mac, binary.BigEndian, block)
+		u := mac.Sum(nil)
+		t := append([]byte{}, u...)
+		for i := 1; i < iterations; i++ {
+			mac.Reset()
+			mac.Write(u)
+			u = mac.Sum(u[:0])
+			for j := range t {
+				t[j] ^= u[j]
+			}
+		}
+		key = append(key, t...)
+	}
+	return key[:keyLen]
+}
+
+func tokenKey(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// currentUsername returns the lower case username of the logged in user, or
+// "" when there is no valid session.
+func currentUsername(r *http.Request) string {
+	cookie, err := r.Cookie(sessionCookie)
+	if err != nil {
+		return ""
+	}
+	accountsMutex.Lock()
+	defer accountsMutex.Unlock()
+	s, ok := accounts.Sessions[tokenKey(cookie.Value)]
+	if !ok || time.Now().After(s.Expires) {
+		return ""
+	}
+	if _, exists := accounts.Accounts[s.Username]; !exists {
+		return ""
+	}
+	return s.Username
+}
+
+// requireLogin passes the logged in user's key to next, or answers 401.
+func requireLogin(next func(w http.ResponseWriter, r *http.Request, username string)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		username := currentUsername(r)
+		if username == "" {
+			http.Error(w, "Login required", http.StatusUnauthorized)
+			return
+		}
+		next(w, r, username)
+	}
+}
+
+type credentials struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+func readCredentials(w http.ResponseWriter, r *http.Request) (credentials, bool) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return credentials{}, false
+	}
+	var c credentials
+	r.Body = http.MaxBytesReader(w, r.Body, maxAccountBody)
+	if err := json.NewDecoder(r.Body).Decode(&c); err != nil {
+		http.Error(w, "Invalid JSON body", http.StatusBadRequest)
+		return credentials{}, false
+	}
+	c.Username = strings.TrimSpace(c.Username)
+	return c, true
+}
+
+func registerHandler(w http.ResponseWriter, r *http.Request) {
+	c, ok := readCredentials(w, r)
+	if !ok || !allowLogin(w, r) {
+		return
+	}
+	if !usernamePattern.MatchString(c.Username) {
+		http.Error(w, "Username must be 3 to 32 letters, digits, '.', '_' or '-'", http.StatusBadRequest)
+		return
+	}
+	if len(c.Password) < minPasswordLength || len(c.Password) > maxPasswordLength {
+		http.Error(w, fmt.Sprintf("Password must be %d to %d characters", minPasswordLength, maxPasswordLength), http.StatusBadRequest)
+		return
+	}
+	var hash string
+	if !withHashSlot(w, r, func() { hash = hashPassword(c.Password) }) {
+		return
+	}
+
+	key := strings.ToLower(c.Username)
+	accountsMutex.Lock()
+	if _, exists := accounts.Accounts[key]; exists {
+		accountsMutex.Unlock()
+		http.Error(w, "Username is taken", http.StatusConflict)
+		return
+	}
+	accounts.Accounts[key] = &Account{Username: c.Username, PasswordHash: hash, LikedCars: []int{}, Created: time.Now()}
+	err := saveAccounts()
+	accountsMutex.Unlock()
+	if err != nil {
+		log.Printf("Failed to save accounts: %v", err)
+		http.Error(w, "Failed to create account", http.StatusInternalServerError)
+		return
+	}
+
+	startSession(w, r, key)
+	w.WriteHeader(http.StatusCreated)
+}
+
+func loginHandler(w http.ResponseWriter, r *http.Request) {
+	c, ok := readCredentials(w, r)
+	if !ok || !allowLogin(w, r) {
+		return
+	}
+	key := strings.ToLower(c.Username)
+	accountsMutex.Lock()
+	hash := dummyHash
+	account, exists := accounts.Accounts[key]
+	if exists {
+		hash = account.PasswordHash
+	}
+	accountsMutex.Unlock()
+
+	var matches bool
+	if !withHashSlot(w, r, func() { matches = checkPassword(c.Password, hash) }) {
+		return
+	}
+	if !matches || !exists {
+		http.Error(w, "Wrong username or password", http.StatusUnauthorized)
+		return
+	}
+	startSession(w, r, key)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// startSession creates a session for the account and sets its cookie.
+func startSession(w http.ResponseWriter, r *http.Request, key string) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		panic(err)
+	}
+	token := base64.RawURLEncoding.EncodeToString(raw)
+	expires := time.Now().Add(sessionLifetime)
+
+	accountsMutex.Lock()
+	accounts.Sessions[tokenKey(token)] = session{Username: key, Expires: expires}
+	err := saveAccounts()
+	accountsMutex.Unlock()
+	if err != nil {
+		log.Printf("Failed to save session: %v", err)
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookie,
+		Value:    token,
+		Path:     "/",
+		Expires:  expires,
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+func logoutHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+	if cookie, err := r.Cookie(sessionCookie); err == nil {
+		accountsMutex.Lock()
+		delete(accounts.Sessions, tokenKey(cookie.Value))
+		if err := saveAccounts(); err != nil {
+			log.Printf("Failed to save accounts: %v", err)
+		}
+		accountsMutex.Unlock()
+	}
+	http.SetCookie(w, &http.Cookie{Name: sessionCookie, Value: "", Path: "/", MaxAge: -1, HttpOnly: true})
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// meHandler tells the page who is logged in.
+func meHandler(w http.ResponseWriter, r *http.Request, username string) {
+	accountsMutex.Lock()
+	account := accounts.Accounts[username]
+	response := map[string]interface{}{
+		"username":  account.Username,
+		"likedCars": append([]int{}, account.LikedCars...),
+	}
+	accountsMutex.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"encoding/hex"
+	"strings"
+	"testing"
+)
+
+func TestPasswordHash(t *testing.T) {
+	hash := hashPassword("correct horse")
+	if !strings.HasPrefix(hash, "pbkdf2-sha256$") {
+		t.Fatalf("hashPassword = %q, want the pbkdf2-sha256 format", hash)
+	}
+	if strings.Contains(hash, "correct horse") {
+		t.Fatalf("hashPassword = %q, which contains the password", hash)
+	}
+	if !checkPassword("correct horse", hash) {
+		t.Error("checkPassword rejects the right password")
+	}
+	if checkPassword("correct horse ", hash) {
+		t.Error("checkPassword accepts a wrong password")
+	}
+	if other := hashPassword("correct horse"); other == hash {
+		t.Error("hashPassword gives the same hash twice, the salt is not random")
+	}
+}
+
+func TestCheckPasswordMalformed(t *testing.T) {
+	for _, encoded := range []string{
+		"",
+		"correct horse",
+		"bcrypt$10$c2FsdA$aGFzaA",
+		"pbkdf2-sha256$0$c2FsdA$aGFzaA",
+		"pbkdf2-sha256$x$c2FsdA$aGFzaA",
+		"pbkdf2-sha256$1$not base64$aGFzaA",
+		"pbkdf2-sha256$1$c2FsdA",
+	} {
+		if checkPassword("correct horse", encoded) {
+			t.Errorf("checkPassword accepts %q", encoded)
+		}
+	}
+}
+
+// RFC 7914 section 11 lists test vectors for PBKDF2-HMAC-SHA256.
+func TestPBKDF2SHA256(t *testing.T) {
+	tests := []struct {
+		password, salt string
+		iterations     int
+		want           string
+	}{
+		{"passwd", "salt", 1, "55ac046e56e3089fec1691c22544b605f94185216dde0465e68b9d57c20dacbc49ca9cccf179b645991664b39d77ef317c71b845b1e30bd509112041d3a19783"},
+		{"Password", "NaCl", 80000, "4ddcd8f60b98be21830cee5ef22701f9641a4418d04c0414aeff08876b34ab56a1d425a1225833549adb841b51c9b3176a272bdebba1d078478f62b397f33c8d"},
+	}
+	for _, tt := range tests {
+		got := hex.EncodeToString(pbkdf2SHA256([]byte(tt.password), []byte(tt.salt), tt.iterations, 64))
+		if got != tt.want {
+			t.Errorf("pbkdf2SHA256(%q, %q, %d) = %s, want %s", tt.password, tt.salt, tt.iterations, got, tt.want)
+		}
+	}
+}
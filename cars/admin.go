@@ -0,0 +1,443 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	errNotFound = errors.New("not found")
+	errInUse    = errors.New("still used by car models")
+	errBadJSON  = errors.New("invalid JSON")
+)
+
+// validationError lists everything wrong with a submitted record.
+type validationError []string
+
+func (v validationError) Error() string {
+	return strings.Join(v, "; ")
+}
+
+// Limits for submitted records.
+const (
+	maxNameLength  = 100
+	firstCarYear   = 1886
+	maxHorsepower  = 2000
+	maxAdminBody   = 1 << 20
+	adminTokenVar  = "CARS_ADMIN_TOKEN"
+	adminAuthRealm = `Bearer realm="cars admin"`
+)
+
+// requireAdmin only lets requests through that carry the token from
+// CARS_ADMIN_TOKEN as "Authorization: Bearer <token>". Without the variable
+// the admin API is switched off.
+func requireAdmin(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token := os.Getenv(adminTokenVar)
+		if token == "" {
+			http.Error(w, "Admin API is disabled", http.StatusForbidden)
+			return
+		}
+		given, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+			w.Header().Set("WWW-Authenticate", adminAuthRealm)
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// adminResource is one kind of record the admin API can change.
+type adminResource struct {
+	create func(r *http.Request) (interface{}, error)
+	update func(id int, r *http.Request) (interface{}, error)
+	remove func(id int) error
+}
+
+// handler serves POST on prefix, and PUT and DELETE on prefix/{id}.
+func (res adminResource) handler(prefix string) http.HandlerFunc {
+	return requireAdmin(func(w http.ResponseWriter, r *http.Request) {
+		r.Body = http.MaxBytesReader(w, r.Body, maxAdminBody)
+		idStr := strings.Trim(strings.TrimPrefix(r.URL.Path, prefix), "/")
+
+		var result interface{}
+		var err error
+		status := http.StatusOK
+		switch {
+		case idStr == "" && r.Method == http.MethodPost:
+			result, err = res.create(r)
+			status = http.StatusCreated
+		case idStr != "" && (r.Method == http.MethodPut || r.Method == http.MethodDelete):
+			id, convErr := strconv.Atoi(idStr)
+			if convErr != nil {
+				http.Error(w, "Invalid ID", http.StatusBadRequest)
+				return
+			}
+			if r.Method == http.MethodPut {
+				result, err = res.update(id, r)
+			} else {
+				err = res.remove(id)
+				status = http.StatusNoContent
+			}
+		default:
+			http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+			return
+		}
+
+		if err != nil {
+			writeAdminError(w, err)
+			return
+		}
+		if result == nil {
+			w.WriteHeader(status)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(result)
+	})
+}
+
+func writeAdminError(w http.ResponseWriter, err error) {
+	var invalid validationError
+	var tooLarge *http.MaxBytesError
+	switch {
+	case errors.As(err, &invalid), errors.Is(err, errBadJSON):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.As(err, &tooLarge):
+		http.Error(w, "Request body too large", http.StatusRequestEntityTooLarge)
+	case errors.Is(err, errNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, errInUse):
+		http.Error(w, err.Error(), http.StatusConflict)
+	default:
+		log.Printf("Admin request failed: %v", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+	}
+}
+
+func decodeBody(r *http.Request, target interface{}) error {
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	err := dec.Decode(target)
+	var tooLarge *http.MaxBytesError
+	if err != nil && !errors.As(err, &tooLarge) {
+		return fmt.Errorf("%w: %v", errBadJSON, err)
+	}
+	return err
+}
+
+func setupAdminHandlers() {
+	http.HandleFunc("/admin/carModels", carModelResource.handler("/admin/carModels"))
+	http.HandleFunc("/admin/carModels/", carModelResource.handler("/admin/carModels"))
+	http.HandleFunc("/admin/manufacturers", manufacturerResource.handler("/admin/manufacturers"))
+	http.HandleFunc("/admin/manufacturers/", manufacturerResource.handler("/admin/manufacturers"))
+	http.HandleFunc("/admin/categories", categoryResource.handler("/admin/categories"))
+	http.HandleFunc("/admin/categories/", categoryResource.handler("/admin/categories"))
+	http.HandleFunc("/admin/carModelImage", requireAdmin(carModelImageHandler))
+}
+
+var carModelResource = adminResource{
+	create: func(r *http.Request) (interface{}, error) {
+		var model CarModel
+		if err := decodeBody(r, &model); err != nil {
+			return nil, err
+		}
+		dataMutex.Lock()
+		defer dataMutex.Unlock()
+		model.ID = 1
+		for _, m := range data.CarModels {
+			if m.ID >= model.ID {
+				model.ID = m.ID + 1
+			}
+		}
+		if err := validateCarModel(&model); err != nil {
+			return nil, err
+		}
+		c := current()
+		c.CarModels = append(append([]CarModel{}, data.CarModels...), model)
+		return model, commit(c)
+	},
+	update: func(id int, r *http.Request) (interface{}, error) {
+		var model CarModel
+		if err := decodeBody(r, &model); err != nil {
+			return nil, err
+		}
+		dataMutex.Lock()
+		defer dataMutex.Unlock()
+		for i := range data.CarModels {
+			if data.CarModels[i].ID != id {
+				continue
+			}
+			model.ID = id
+			if model.Image == "" {
+				// Keep the current image, which may have been uploaded
+				model.Image = data.CarModels[i].Image
+				model.Thumbnail = data.CarModels[i].Thumbnail
+			}
+			if err := validateCarModel(&model); err != nil {
+				return nil, err
+			}
+			old := data.CarModels[i].Image
+			c := current()
+			c.CarModels = append([]CarModel{}, data.CarModels...)
+			c.CarModels[i] = model
+			if err := commit(c); err != nil {
+				return nil, err
+			}
+			if model.Image != old {
+				removeUpload(old)
+			}
+			return model, nil
+		}
+		return nil, fmt.Errorf("car model %d %w", id, errNotFound)
+	},
+	remove: func(id int) error {
+		dataMutex.Lock()
+		defer dataMutex.Unlock()
+		for i, m := range data.CarModels {
+			if m.ID == id {
+				c := current()
+				c.CarModels = append(append([]CarModel{}, data.CarModels[:i]...), data.CarModels[i+1:]...)
+				if err := commit(c); err != nil {
+					return err
+				}
+				removeUpload(m.Image)
+				return nil
+			}
+		}
+		return fmt.Errorf("car model %d %w", id, errNotFound)
+	},
+}
+
+var manufacturerResource = adminResource{
+	create: func(r *http.Request) (interface{}, error) {
+		var manufacturer Manufacturer
+		if err := decodeBody(r, &manufacturer); err != nil {
+			return nil, err
+		}
+		dataMutex.Lock()
+		defer dataMutex.Unlock()
+		manufacturer.ID = 1
+		for _, m := range data.Manufacturers {
+			if m.ID >= manufacturer.ID {
+				manufacturer.ID = m.ID + 1
+			}
+		}
+		if err := validateManufacturer(&manufacturer); err != nil {
+			return nil, err
+		}
+		c := current()
+		c.Manufacturers = append(append([]Manufacturer{}, data.Manufacturers...), manufacturer)
+		return manufacturer, commit(c)
+	},
+	update: func(id int, r *http.Request) (interface{}, error) {
+		var manufacturer Manufacturer
+		if err := decodeBody(r, &manufacturer); err != nil {
+			return nil, err
+		}
+		dataMutex.Lock()
+		defer dataMutex.Unlock()
+		for i := range data.Manufacturers {
+			if data.Manufacturers[i].ID != id {
+				continue
+			}
+			manufacturer.ID = id
+			if err := validateManufacturer(&manufacturer); err != nil {
+				return nil, err
+			}
+			c := current()
+			c.Manufacturers = append([]Manufacturer{}, data.Manufacturers...)
+			c.Manufacturers[i] = manufacturer
+			return manufacturer, commit(c)
+		}
+		return nil, fmt.Errorf("manufacturer %d %w", id, errNotFound)
+	},
+	remove: func(id int) error {
+		dataMutex.Lock()
+		defer dataMutex.Unlock()
+		for _, m := range data.CarModels {
+			if m.ManufacturerID == id {
+				return fmt.Errorf("manufacturer %d is %w", id, errInUse)
+			}
+		}
+		for i, m := range data.Manufacturers {
+			if m.ID == id {
+				c := current()
+				c.Manufacturers = append(append([]Manufacturer{}, data.Manufacturers[:i]...), data.Manufacturers[i+1:]...)
+				return commit(c)
+			}
+		}
+		return fmt.Errorf("manufacturer %d %w", id, errNotFound)
+	},
+}
+
+var categoryResource = adminResource{
+	create: func(r *http.Request) (interface{}, error) {
+		var category Category
+		if err := decodeBody(r, &category); err != nil {
+			return nil, err
+		}
+		dataMutex.Lock()
+		defer dataMutex.Unlock()
+		category.ID = 1
+		for _, c := range data.Categories {
+			if c.ID >= category.ID {
+				category.ID = c.ID + 1
+			}
+		}
+		if err := validateCategory(&category); err != nil {
+			return nil, err
+		}
+		c := current()
+		c.Categories = append(append([]Category{}, data.Categories...), category)
+		return category, commit(c)
+	},
+	update: func(id int, r *http.Request) (interface{}, error) {
+		var category Category
+		if err := decodeBody(r, &category); err != nil {
+			return nil, err
+		}
+		dataMutex.Lock()
+		defer dataMutex.Unlock()
+		for i := range data.Categories {
+			if data.Categories[i].ID != id {
+				continue
+			}
+			category.ID = id
+			if err := validateCategory(&category); err != nil {
+				return nil, err
+			}
+			c := current()
+			c.Categories = append([]Category{}, data.Categories...)
+			c.Categories[i] = category
+			return category, commit(c)
+		}
+		return nil, fmt.Errorf("category %d %w", id, errNotFound)
+	},
+	remove: func(id int) error {
+		dataMutex.Lock()
+		defer dataMutex.Unlock()
+		for _, m := range data.CarModels {
+			if m.CategoryID == id {
+				return fmt.Errorf("category %d is %w", id, errInUse)
+			}
+		}
+		for i, category := range data.Categories {
+			if category.ID == id {
+				c := current()
+				c.Categories = append(append([]Category{}, data.Categories[:i]...), data.Categories[i+1:]...)
+				return commit(c)
+			}
+		}
+		return fmt.Errorf("category %d %w", id, errNotFound)
+	},
+}
+
+// validateCarModel checks a car model against the rest of the catalog. The
+// caller must hold dataMutex.
+func validateCarModel(m *CarModel) error {
+	var problems validationError
+	m.Name = strings.TrimSpace(m.Name)
+	problems.checkName("name", m.Name)
+	for _, other := range data.CarModels {
+		if other.ID != m.ID && strings.EqualFold(other.Name, m.Name) {
+			problems = append(problems, fmt.Sprintf("a car model named %q already exists", m.Name))
+		}
+	}
+
+	found := false
+	for _, manufacturer := range data.Manufacturers {
+		found = found || manufacturer.ID == m.ManufacturerID
+	}
+	if !found {
+		problems = append(problems, fmt.Sprintf("manufacturerId %d does not exist", m.ManufacturerID))
+	}
+	found = false
+	for _, category := range data.Categories {
+		found = found || category.ID == m.CategoryID
+	}
+	if !found {
+		problems = append(problems, fmt.Sprintf("categoryId %d does not exist", m.CategoryID))
+	}
+
+	if latest := time.Now().Year() + 2; m.Year < firstCarYear || m.Year > latest {
+		problems = append(problems, fmt.Sprintf("year must be between %d and %d", firstCarYear, latest))
+	}
+	if m.Specifications.Horsepower < 1 || m.Specifications.Horsepower > maxHorsepower {
+		problems = append(problems, fmt.Sprintf("horsepower must be between 1 and %d", maxHorsepower))
+	}
+	spec := &m.Specifications
+	spec.Engine = strings.TrimSpace(spec.Engine)
+	spec.Transmission = strings.TrimSpace(spec.Transmission)
+	spec.Drivetrain = strings.TrimSpace(spec.Drivetrain)
+	problems.checkName("engine", spec.Engine)
+	problems.checkName("transmission", spec.Transmission)
+	problems.checkName("drivetrain", spec.Drivetrain)
+	spec.ParsedSpecifications = parseSpecifications(*spec)
+	m.Image = imagePath(strings.TrimSpace(m.Image))
+	m.Thumbnail = strings.TrimSpace(m.Thumbnail)
+
+	if len(problems) > 0 {
+		return problems
+	}
+	return nil
+}
+
+// validateManufacturer checks a manufacturer against the others. The caller
+// must hold dataMutex.
+func validateManufacturer(m *Manufacturer) error {
+	var problems validationError
+	m.Name = strings.TrimSpace(m.Name)
+	m.Country = strings.TrimSpace(m.Country)
+	problems.checkName("name", m.Name)
+	problems.checkName("country", m.Country)
+	for _, other := range data.Manufacturers {
+		if other.ID != m.ID && strings.EqualFold(other.Name, m.Name) {
+			problems = append(problems, fmt.Sprintf("a manufacturer named %q already exists", m.Name))
+		}
+	}
+	if now := time.Now().Year(); m.FoundingYear < 1700 || m.FoundingYear > now {
+		problems = append(problems, fmt.Sprintf("foundingYear must be between 1700 and %d", now))
+	}
+	if len(problems) > 0 {
+		return problems
+	}
+	return nil
+}
+
+// validateCategory checks a category against the others. The caller must
+// hold dataMutex.
+func validateCategory(c *Category) error {
+	var problems validationError
+	c.Name = strings.TrimSpace(c.Name)
+	problems.checkName("name", c.Name)
+	for _, other := range data.Categories {
+		if other.ID != c.ID && strings.EqualFold(other.Name, c.Name) {
+			problems = append(problems, fmt.Sprintf("a category named %q already exists", c.Name))
+		}
+	}
+	if len(problems) > 0 {
+		return problems
+	}
+	return nil
+}
+
+// checkName requires a non-empty text field of reasonable length.
+func (v *validationError) checkName(field, value string) {
+	switch {
+	case value == "":
+		*v = append(*v, field+" is required")
+	case len(value) > maxNameLength:
+		*v = append(*v, fmt.Sprintf("%s must be at most %d characters", field, maxNameLength))
+	}
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// Defaults for the upstream API cache, overridden by CARS_API_CACHE_TTL and
+// CARS_API_CACHE_STALE.
+const (
+	defaultCacheTTL   = time.Minute
+	defaultCacheStale = 10 * time.Minute
+	maxUpstreamBody   = 10 << 20
+)
+
+// cacheEntry is the last good response for one URL.
+type cacheEntry struct {
+	body    []byte
+	etag    string
+	fetched time.Time
+}
+
+// upstreamCall is a fetch in flight that concurrent callers wait for.
+type upstreamCall struct {
+	done chan struct{}
+	body []byte
+	err  error
+}
+
+// apiCache sits in front of the upstream API. A response younger than ttl
+// is served from memory. An older one is still served for up to stale
+// longer while it is refreshed in the background, or when the upstream is
+// down. Refreshes send If-None-Match, so an unchanged response costs a 304.
+type apiCache struct {
+	client  *http.Client
+	ttl     time.Duration
+	stale   time.Duration
+	mu      sync.Mutex
+	entries map[string]*cacheEntry
+	calls   map[string]*upstreamCall
+}
+
+var upstream = newAPICache()
+
+func newAPICache() *apiCache {
+	return &apiCache{
+		client:  &http.Client{Timeout: 10 * time.Second},
+		ttl:     durationEnv("CARS_API_CACHE_TTL", defaultCacheTTL),
+		stale:   durationEnv("CARS_API_CACHE_STALE", defaultCacheStale),
+		entries: map[string]*cacheEntry{},
+		calls:   map[string]*upstreamCall{},
+	}
+}
+
+// get returns the body for url from the cache or the upstream.
+func (c *apiCache) get(url string) ([]byte, error) {
+	c.mu.Lock()
+	entry := c.entries[url]
+	if entry != nil {
+		age := time.Since(entry.fetched)
+		if age < c.ttl {
+			c.mu.Unlock()
+			return entry.body, nil
+		}
+		if age < c.ttl+c.stale {
+			// Serve the old body now and refresh it for the next caller
+			if _, refreshing := c.calls[url]; !refreshing {
+				c.start(url, entry)
+			}
+			c.mu.Unlock()
+			return entry.body, nil
+		}
+	}
+	call, ok := c.calls[url]
+	if !ok {
+		call = c.start(url, entry)
+	}
+	c.mu.Unlock()
+
+	<-call.done
+	return call.body, call.err
+}
+
+// start fetches url in the background. The caller must hold c.mu.
+func (c *apiCache) start(url string, entry *cacheEntry) *upstreamCall {
+	call := &upstreamCall{done: make(chan struct{})}
+	c.calls[url] = call
+	go func() {
+		body, err := c.fetch(url, entry)
+
+		c.mu.Lock()
+		delete(c.calls, url)
+		if err != nil {
+			// Fall back to a stale copy while the upstream is down
+			if old := c.entries[url]; old != nil && time.Since(old.fetched) < c.ttl+c.stale {
+				log.Printf("Serving stale %s: %v", url, err)
+				body, err = old.body, nil
+			}
+		}
+		c.mu.Unlock()
+
+		call.body, call.err = body, err
+		close(call.done)
+	}()
+	return call
+}
+
+// fetch requests url, revalidating entry if there is one, and stores a good
+// response.
+func (c *apiCache) fetch(url string, entry *cacheEntry) ([]byte, error) {
+	log.Printf("Fetching API URL: %s", url)
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	if entry != nil && entry.etag != "" {
+		req.Header.Set("If-None-Match", entry.etag)
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to make GET request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var fresh cacheEntry
+	switch {
+	case resp.StatusCode == http.StatusNotModified && entry != nil:
+		fresh = *entry
+	case resp.StatusCode == http.StatusOK:
+		// Read one byte more than allowed to tell a full body from a cut one
+		body, err := io.ReadAll(io.LimitReader(resp.Body, maxUpstreamBody+1))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read API response: %w", err)
+		}
+		if len(body) > maxUpstreamBody {
+			return nil, fmt.Errorf("API response too large: over %d bytes", maxUpstreamBody)
+		}
+		fresh = cacheEntry{body: body, etag: resp.Header.Get("ETag")}
+	default:
+		return nil, fmt.Errorf("failed to fetch data from API: %s", resp.Status)
+	}
+	fresh.fetched = time.Now()
+
+	c.mu.Lock()
+	c.entries[url] = &fresh
+	c.mu.Unlock()
+	return fresh.body, nil
+}
+
+// durationEnv reads a duration such as "30s" from the environment.
+func durationEnv(name string, fallback time.Duration) time.Duration {
+	value := os.Getenv(name)
+	if value == "" {
+		return fallback
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d < 0 {
+		log.Printf("Ignoring invalid %s %q", name, value)
+		return fallback
+	}
+	return d
+}
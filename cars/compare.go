@@ -0,0 +1,341 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const maxCompared = 10
+
+// comparedCar is one car of a comparison with its related records.
+type comparedCar struct {
+	CarModel     CarModel      `json:"carModel"`
+	Manufacturer *Manufacturer `json:"manufacturer,omitempty"`
+	Category     *Category     `json:"category,omitempty"`
+}
+
+// comparedValue is one car's value of an attribute. Number and Delta are
+// only set for numeric attributes; Delta is the difference to the first car.
+type comparedValue struct {
+	Text   string   `json:"text"`
+	Number *float64 `json:"number,omitempty"`
+	Delta  *float64 `json:"delta,omitempty"`
+	Best   bool     `json:"best,omitempty"`
+}
+
+// comparedAttribute is one row of a comparison, with a value per car.
+type comparedAttribute struct {
+	Key    string          `json:"key"`
+	Label  string          `json:"label"`
+	Unit   string          `json:"unit,omitempty"`
+	Values []comparedValue `json:"values"`
+}
+
+type comparison struct {
+	Cars       []comparedCar       `json:"cars"`
+	Attributes []comparedAttribute `json:"attributes"`
+	ShareURL   string              `json:"shareUrl"`
+	CSVURL     string              `json:"csvUrl"`
+}
+
+// attribute describes how to read one row of a comparison. Numeric
+// attributes have a number func; higherIsBetter marks the ones where a best
+// value makes sense.
+type attribute struct {
+	key, label, unit string
+	text             func(c comparedCar) string
+	number           func(c comparedCar) (float64, bool)
+	higherIsBetter   bool
+}
+
+var comparedAttributes = []attribute{
+	{key: "manufacturer", label: "Manufacturer", text: func(c comparedCar) string {
+		if c.Manufacturer == nil {
+			return ""
+		}
+		return c.Manufacturer.Name
+	}},
+	{key: "country", label: "Country", text: func(c comparedCar) string {
+		if c.Manufacturer == nil {
+			return ""
+		}
+		return c.Manufacturer.Country
+	}},
+	{key: "foundingYear", label: "Founding year", number: func(c comparedCar) (float64, bool) {
+		if c.Manufacturer == nil {
+			return 0, false
+		}
+		return float64(c.Manufacturer.FoundingYear), c.Manufacturer.FoundingYear > 0
+	}},
+	{key: "category", label: "Category", text: func(c comparedCar) string {
+		if c.Category == nil {
+			return ""
+		}
+		return c.Category.Name
+	}},
+	{key: "year", label: "Year", higherIsBetter: true, number: func(c comparedCar) (float64, bool) {
+		return float64(c.CarModel.Year), c.CarModel.Year > 0
+	}},
+	{key: "engine", label: "Engine", text: func(c comparedCar) string {
+		return c.CarModel.Specifications.Engine
+	}},
+	{key: "displacement", label: "Displacement", unit: "L", number: func(c comparedCar) (float64, bool) {
+		return c.CarModel.Specifications.DisplacementLiters, c.CarModel.Specifications.DisplacementLiters > 0
+	}},
+	{key: "cylinders", label: "Cylinders", number: func(c comparedCar) (float64, bool) {
+		return float64(c.CarModel.Specifications.Cylinders), c.CarModel.Specifications.Cylinders > 0
+	}},
+	{key: "layout", label: "Layout", text: func(c comparedCar) string {
+		return c.CarModel.Specifications.Layout
+	}},
+	{key: "horsepower", label: "Horsepower", unit: "hp", higherIsBetter: true, number: func(c comparedCar) (float64, bool) {
+		return float64(c.CarModel.Specifications.Horsepower), c.CarModel.Specifications.Horsepower > 0
+	}},
+	{key: "specificOutput", label: "Horsepower per liter", unit: "hp/L", higherIsBetter: true, number: func(c comparedCar) (float64, bool) {
+		if c.CarModel.Specifications.DisplacementLiters == 0 || c.CarModel.Specifications.Horsepower == 0 {
+			return 0, false
+		}
+		return float64(c.CarModel.Specifications.Horsepower) / c.CarModel.Specifications.DisplacementLiters, true
+	}},
+	{key: "transmission", label: "Transmission", text: func(c comparedCar) string {
+		return c.CarModel.Specifications.Transmission
+	}},
+	{key: "gears", label: "Gears", number: func(c comparedCar) (float64, bool) {
+		return float64(c.CarModel.Specifications.Gears), c.CarModel.Specifications.Gears > 0
+	}},
+	{key: "transmissionType", label: "Transmission type", text: func(c comparedCar) string {
+		return c.CarModel.Specifications.TransmissionType
+	}},
+	{key: "drivetrain", label: "Drivetrain", text: func(c comparedCar) string {
+		return c.CarModel.Specifications.Drivetrain
+	}},
+	{key: "driveType", label: "Drive type", text: func(c comparedCar) string {
+		return c.CarModel.Specifications.DriveType
+	}},
+}
+
+// compare builds the comparison of the given car models, in order.
+func compare(models []CarModel) comparison {
+	c := comparison{Cars: []comparedCar{}, Attributes: []comparedAttribute{}}
+	for _, m := range models {
+		c.Cars = append(c.Cars, comparedCar{
+			CarModel:     m,
+			Manufacturer: getManufacturerByID(m.ManufacturerID),
+			Category:     getCategoryByID(m.CategoryID),
+		})
+	}
+	ids := strings.Join(idStrings(models), ",")
+	c.ShareURL = "/static/compare.html?ids=" + ids
+	c.CSVURL = "/compareCarModels?ids=" + ids + "&format=csv"
+
+	for _, attr := range comparedAttributes {
+		c.Attributes = append(c.Attributes, attr.compare(c.Cars))
+	}
+	return c
+}
+
+// compare reads the attribute of every car and works out deltas and the
+// best value.
+func (a attribute) compare(cars []comparedCar) comparedAttribute {
+	row := comparedAttribute{Key: a.key, Label: a.label, Unit: a.unit, Values: make([]comparedValue, len(cars))}
+	if a.number == nil {
+		for i, car := range cars {
+			row.Values[i].Text = a.text(car)
+		}
+		return row
+	}
+
+	known := 0
+	var best, lowest float64
+	for i, car := range cars {
+		n, ok := a.number(car)
+		if !ok {
+			continue
+		}
+		n = roundTenth(n)
+		row.Values[i].Number = &n
+		row.Values[i].Text = formatNumber(n, a.unit)
+		if known == 0 || n > best {
+			best = n
+		}
+		if known == 0 || n < lowest {
+			lowest = n
+		}
+		known++
+	}
+
+	if first := row.Values[0].Number; first != nil {
+		for i := range row.Values {
+			if n := row.Values[i].Number; n != nil {
+				delta := roundTenth(*n - *first)
+				row.Values[i].Delta = &delta
+			}
+		}
+	}
+	// A best value only means something when there is a difference
+	if a.higherIsBetter && known > 1 && best != lowest {
+		for i := range row.Values {
+			if n := row.Values[i].Number; n != nil && *n == best {
+				row.Values[i].Best = true
+			}
+		}
+	}
+	return row
+}
+
+func idStrings(models []CarModel) []string {
+	ids := make([]string, len(models))
+	for i, m := range models {
+		ids[i] = strconv.Itoa(m.ID)
+	}
+	return ids
+}
+
+func roundTenth(n float64) float64 {
+	if n < 0 {
+		return -roundTenth(-n)
+	}
+	return float64(int64(n*10+0.5)) / 10
+}
+
+func formatNumber(n float64, unit string) string {
+	text := strconv.FormatFloat(n, 'f', -1, 64)
+	if unit != "" {
+		text += " " + unit
+	}
+	return text
+}
+
+// writeCSV writes the comparison with a column per car, followed by rows
+// with the differences to the first car and a column naming the best cars.
+func (c comparison) writeCSV(w *csv.Writer) error {
+	header := []string{"Attribute"}
+	for _, car := range c.Cars {
+		header = append(header, car.CarModel.Name)
+	}
+	header = append(header, "Best")
+	if err := w.Write(header); err != nil {
+		return err
+	}
+
+	var deltaRows [][]string
+	for _, attr := range c.Attributes {
+		label := attr.Label
+		if attr.Unit != "" {
+			label += " (" + attr.Unit + ")"
+		}
+		row := []string{label}
+		deltaRow := []string{label + " vs " + c.Cars[0].CarModel.Name}
+		var best []string
+		hasDelta := false
+		for i, value := range attr.Values {
+			text := value.Text
+			if value.Number != nil {
+				text = strconv.FormatFloat(*value.Number, 'f', -1, 64)
+			}
+			row = append(row, text)
+			if value.Best {
+				best = append(best, c.Cars[i].CarModel.Name)
+			}
+			delta := ""
+			if value.Delta != nil {
+				delta = strconv.FormatFloat(*value.Delta, 'f', -1, 64)
+				if *value.Delta > 0 {
+					delta = "+" + delta
+				}
+				hasDelta = true
+			}
+			deltaRow = append(deltaRow, delta)
+		}
+		if err := w.Write(append(row, strings.Join(best, "; "))); err != nil {
+			return err
+		}
+		if hasDelta && len(c.Cars) > 1 {
+			deltaRows = append(deltaRows, append(deltaRow, ""))
+		}
+	}
+	if err := w.WriteAll(deltaRows); err != nil {
+		return err
+	}
+	return w.Error()
+}
+
+// compareCarModelsHandler compares the car models in "ids" side by side, as
+// JSON or, with format=csv, as a CSV download. The compare page POSTs the
+// ids, which also records the comparison in the user's history. A GET, such
+// as a shared link, its preview or a CSV download, records nothing.
+func compareCarModelsHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+	case http.MethodPost:
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, "Failed to parse form data", http.StatusBadRequest)
+			return
+		}
+		query = r.PostForm
+	default:
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+	format := query.Get("format")
+	if format != "" && format != "json" && format != "csv" {
+		http.Error(w, "format must be json or csv", http.StatusBadRequest)
+		return
+	}
+	ids := list(query, "ids")
+	if len(ids) == 0 {
+		http.Error(w, "ids is required", http.StatusBadRequest)
+		return
+	}
+	if len(ids) > maxCompared {
+		http.Error(w, fmt.Sprintf("At most %d car models can be compared", maxCompared), http.StatusBadRequest)
+		return
+	}
+
+	var models []CarModel
+	var modelIDs []int
+	for _, idStr := range ids {
+		id, err := strconv.Atoi(idStr)
+		if err != nil {
+			http.Error(w, "Invalid car model ID", http.StatusBadRequest)
+			return
+		}
+
+		model := getCarModelByID(id)
+		if model == nil {
+			http.Error(w, "Car model not found", http.StatusNotFound)
+			return
+		}
+
+		models = append(models, *model)
+		modelIDs = append(modelIDs, id)
+	}
+	if r.Method == http.MethodPost && format != "csv" {
+		recordInteraction(w, r, interactionCompare, modelIDs...)
+	}
+
+	result := compare(models)
+	if format == "csv" {
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		w.Header().Set("Content-Disposition", `attachment; filename="comparison-`+strings.Join(idStrings(models), "-")+`.csv"`)
+		if err := result.writeCSV(csv.NewWriter(w)); err != nil {
+			log.Println("Failed to write comparison CSV:", err)
+		}
+		return
+	}
+
+	jsonResponse, err := json.Marshal(result)
+	if err != nil {
+		http.Error(w, "Failed to marshal comparison data", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(jsonResponse)
+}
@@ -1,11 +1,14 @@
 package main
 
 import (
+	"crypto/sha256"
 	"encoding/json"
 	"fmt"
 	"log"
-	"net/http"
+	"os"
+	"strings"
 	"sync"
+	"time"
 )
 
 type Specifications struct {
@@ -13,6 +16,9 @@ type Specifications struct {
 	Horsepower   int    `json:"horsepower"`
 	Transmission string `json:"transmission"`
 	Drivetrain   string `json:"drivetrain"`
+	// ParsedSpecifications is read from the strings above whenever a car
+	// model is loaded or saved, so it never disagrees with them.
+	ParsedSpecifications
 }
 
 type CarModel struct {
@@ -23,6 +29,7 @@ type CarModel struct {
 	Year           int            `json:"year"`
 	Specifications Specifications `json:"specifications"`
 	Image          string         `json:"image"`
+	Thumbnail      string         `json:"thumbnail,omitempty"`
 }
 
 type Manufacturer struct {
@@ -38,65 +45,152 @@ type Category struct {
 }
 
 type Data struct {
-	Manufacturers  []Manufacturer `json:"manufacturers"`
-	Categories     []Category     `json:"categories"`
-	CarModels      []CarModel     `json:"carModels"`
-	RecommendedIDs []int          `json:"recommendedIDs"`
+	Manufacturers []Manufacturer `json:"manufacturers"`
+	Categories    []Category     `json:"categories"`
+	CarModels     []CarModel     `json:"carModels"`
 }
 
-// global variable to hold the data
+// global variable to hold the data, guarded by dataMutex
 var data Data
+var dataMutex sync.RWMutex
 
-const apiBaseURL = "http://localhost:8080/api"
-
-func fetchAPI(endpoint string, target interface{}) error {
-	url := fmt.Sprintf("%s/%s", apiBaseURL, endpoint)
-	log.Printf("Fetching API URL: %s", url)
-	resp, err := http.Get(url)
+// fetchAPI decodes the JSON at endpoint of the upstream API at baseURL into
+// target, and returns the body so the caller can tell whether it changed.
+// Responses go through the upstream cache.
+func fetchAPI(baseURL, endpoint string, target interface{}) ([]byte, error) {
+	body, err := upstream.get(fmt.Sprintf("%s/%s", strings.TrimRight(baseURL, "/"), endpoint))
 	if err != nil {
-		return fmt.Errorf("failed to make GET request: %w", err)
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("failed to fetch data from API: %s", resp.Status)
+		return nil, err
 	}
+	return body, json.Unmarshal(body, target)
+}
 
-	return json.NewDecoder(resp.Body).Decode(target)
+// lastImport is what the last import from the upstream API brought in: a
+// checksum of the responses, and the catalog as it was served. It is guarded
+// by dataMutex.
+var lastImport struct {
+	sum     [sha256.Size]byte
+	catalog catalog
 }
 
-func loadData() {
+// importFromAPI merges the data served by the API at baseURL into the
+// catalog. Nothing is saved when the upstream serves the same data as the
+// last time.
+func importFromAPI(baseURL string) error {
+	var imported catalog
 	var wg sync.WaitGroup
+	bodies := make([][]byte, 3)
+	errs := make([]error, 3)
 	wg.Add(3)
 
 	go func() {
 		defer wg.Done()
-		err := fetchAPI("manufacturers", &data.Manufacturers)
-		if err != nil {
-			log.Fatalf("Error fetching manufacturers data: %v", err)
-		}
+		bodies[0], errs[0] = fetchAPI(baseURL, "manufacturers", &imported.Manufacturers)
 	}()
 
 	go func() {
 		defer wg.Done()
-		err := fetchAPI("categories", &data.Categories)
-		if err != nil {
-			log.Fatalf("Error fetching categories data: %v", err)
-		}
+		bodies[1], errs[1] = fetchAPI(baseURL, "categories", &imported.Categories)
 	}()
 
 	go func() {
 		defer wg.Done()
-		err := fetchAPI("carModels", &data.CarModels)
-		if err != nil {
-			log.Fatalf("Error fetching car models data: %v", err)
-		}
+		bodies[2], errs[2] = fetchAPI(baseURL, "carModels", &imported.CarModels)
 	}()
 
 	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+
+	hash := sha256.New()
+	for _, body := range bodies {
+		hash.Write(body)
+		hash.Write([]byte{0})
+	}
+	var sum [sha256.Size]byte
+	copy(sum[:], hash.Sum(nil))
+
+	imported.prepare()
+	dataMutex.Lock()
+	defer dataMutex.Unlock()
+	if sum == lastImport.sum {
+		return nil
+	}
+	if err := commit(mergeImport(current(), lastImport.catalog, imported)); err != nil {
+		return err
+	}
+	lastImport.sum = sum
+	lastImport.catalog = imported
+	return nil
+}
+
+// mergeImport merges an imported catalog into the local one, given base, the
+// catalog the previous import brought in.
+func mergeImport(local, base, imported catalog) catalog {
+	merged := catalog{
+		Manufacturers: mergeRecords(local.Manufacturers, base.Manufacturers, imported.Manufacturers, func(m Manufacturer) int { return m.ID }),
+		Categories:    mergeRecords(local.Categories, base.Categories, imported.Categories, func(c Category) int { return c.ID }),
+		CarModels:     mergeRecords(local.CarModels, base.CarModels, imported.CarModels, func(m CarModel) int { return m.ID }),
+	}
+	// Images uploaded here only exist here, so they outlive upstream changes
+	uploads := map[int]CarModel{}
+	for _, model := range local.CarModels {
+		if isUpload(model.Image) {
+			uploads[model.ID] = model
+		}
+	}
+	for i, model := range merged.CarModels {
+		if local, ok := uploads[model.ID]; ok {
+			merged.CarModels[i].Image = local.Image
+			merged.CarModels[i].Thumbnail = local.Thumbnail
+		}
+	}
+	return merged
+}
+
+// mergeRecords merges imported records into local ones by ID. A record the
+// upstream serves replaces the local one, unless it was edited or deleted
+// here since the last import, that is when it differs from the one in base.
+// Records added here are kept, and records the upstream no longer serves are
+// dropped.
+func mergeRecords[T comparable](local, base, imported []T, id func(T) int) []T {
+	localByID := make(map[int]T, len(local))
+	for _, record := range local {
+		localByID[id(record)] = record
+	}
+	baseByID := make(map[int]T, len(base))
+	for _, record := range base {
+		baseByID[id(record)] = record
+	}
+
+	merged := make([]T, 0, len(imported))
+	served := make(map[int]bool, len(imported))
+	for _, record := range imported {
+		served[id(record)] = true
+		old, inBase := baseByID[id(record)]
+		mine, inLocal := localByID[id(record)]
+		switch {
+		case inBase && !inLocal:
+			continue
+		case inBase && mine != old:
+			record = mine
+		}
+		merged = append(merged, record)
+	}
+	for _, record := range local {
+		if _, inBase := baseByID[id(record)]; !inBase && !served[id(record)] {
+			merged = append(merged, record)
+		}
+	}
+	return merged
 }
 
 func getManufacturerByID(id int) *Manufacturer {
+	dataMutex.RLock()
+	defer dataMutex.RUnlock()
 	for _, manufacturer := range data.Manufacturers {
 		if manufacturer.ID == id {
 			return &manufacturer
@@ -104,3 +198,54 @@ func getManufacturerByID(id int) *Manufacturer {
 	}
 	return nil
 }
+
+func getCategoryByID(id int) *Category {
+	dataMutex.RLock()
+	defer dataMutex.RUnlock()
+	for _, category := range data.Categories {
+		if category.ID == id {
+			return &category
+		}
+	}
+	return nil
+}
+
+func getCarModelByID(id int) *CarModel {
+	dataMutex.RLock()
+	defer dataMutex.RUnlock()
+	for _, model := range data.CarModels {
+		if model.ID == id {
+			return &model
+		}
+	}
+	return nil
+}
+
+// snapshot returns copies of the catalog lists that are safe to use without
+// holding dataMutex.
+func snapshot() ([]Manufacturer, []Category, []CarModel) {
+	dataMutex.RLock()
+	defer dataMutex.RUnlock()
+	return append([]Manufacturer{}, data.Manufacturers...),
+		append([]Category{}, data.Categories...),
+		append([]CarModel{}, data.CarModels...)
+}
+
+// startImportSync imports the catalog from CARS_IMPORT_URL again every
+// CARS_IMPORT_INTERVAL, so changes made upstream show up without a restart.
+// Nothing happens unless both are set.
+func startImportSync() {
+	url := os.Getenv("CARS_IMPORT_URL")
+	interval := durationEnv("CARS_IMPORT_INTERVAL", 0)
+	if url == "" || interval == 0 {
+		return
+	}
+	log.Printf("Re-importing data from %s every %s", url, interval)
+	go func() {
+		for range time.Tick(interval) {
+			if err := importFromAPI(url); err != nil {
+				log.Printf("Error re-importing data from %s: %v", url, err)
+			}
+		}
+	}()
+}
@@ -0,0 +1,336 @@
+package main
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+)
+
+// How much a match in each field counts towards a car's score.
+const (
+	weightName         = 3
+	weightManufacturer = 2
+	weightCategory     = 1.5
+	weightSpec         = 1
+	weightCountry      = 0.5
+)
+
+// How much each kind of term match is worth.
+const (
+	scoreExact  = 1.0
+	scorePrefix = 0.8
+	scoreTypo   = 0.6
+)
+
+const maxSuggestions = 8
+
+// posting is a car model containing a term, with the weight of the best
+// field it appears in.
+type posting struct {
+	id     int
+	weight float64
+}
+
+// searchIndex is an inverted index over the catalog.
+type searchIndex struct {
+	version  int
+	postings map[string][]posting
+	// terms holds every indexed term in order, for prefix lookups.
+	terms  []string
+	models map[int]CarModel
+	order  []int
+	makers map[int]Manufacturer
+}
+
+// searchHit is a car model with its relevance score.
+type searchHit struct {
+	CarModel
+	Score float64 `json:"score"`
+}
+
+// suggestion is an autocomplete entry.
+type suggestion struct {
+	Text string `json:"text"`
+	Type string `json:"type"`
+	ID   int    `json:"id"`
+}
+
+var (
+	index      *searchIndex
+	indexMutex sync.Mutex
+)
+
+// currentIndex returns the index for the catalog, rebuilding it after the
+// catalog has changed.
+func currentIndex() *searchIndex {
+	indexMutex.Lock()
+	defer indexMutex.Unlock()
+	dataMutex.RLock()
+	defer dataMutex.RUnlock()
+	if index == nil || index.version != catalogVersion {
+		index = buildIndex(catalogVersion, data.Manufacturers, data.Categories, data.CarModels)
+	}
+	return index
+}
+
+func buildIndex(version int, manufacturers []Manufacturer, categories []Category, models []CarModel) *searchIndex {
+	idx := &searchIndex{
+		version:  version,
+		postings: map[string][]posting{},
+		models:   map[int]CarModel{},
+		makers:   map[int]Manufacturer{},
+	}
+	categoryNames := map[int]string{}
+	for _, c := range categories {
+		categoryNames[c.ID] = c.Name
+	}
+	for _, m := range manufacturers {
+		idx.makers[m.ID] = m
+	}
+
+	for _, car := range models {
+		idx.models[car.ID] = car
+		idx.order = append(idx.order, car.ID)
+		maker := idx.makers[car.ManufacturerID]
+		best := map[string]float64{}
+		for _, field := range []struct {
+			text   string
+			weight float64
+		}{
+			{car.Name, weightName},
+			{maker.Name, weightManufacturer},
+			{categoryNames[car.CategoryID], weightCategory},
+			{strconv.Itoa(car.Year), weightSpec},
+			{car.Specifications.Engine, weightSpec},
+			{car.Specifications.Transmission, weightSpec},
+			{car.Specifications.Drivetrain, weightSpec},
+			{initials(car.Specifications.Drivetrain), weightSpec},
+			{maker.Country, weightCountry},
+		} {
+			for _, term := range tokenize(field.text) {
+				if field.weight > best[term] {
+					best[term] = field.weight
+				}
+			}
+		}
+		for term, weight := range best {
+			idx.postings[term] = append(idx.postings[term], posting{car.ID, weight})
+		}
+	}
+
+	for term := range idx.postings {
+		idx.terms = append(idx.terms, term)
+	}
+	sort.Strings(idx.terms)
+	return idx
+}
+
+// tokenize splits text into lower case words. Words with a hyphen or a
+// switch between letters and digits are also indexed joined together, so
+// "F-150" gives "f", "150" and "f150".
+func tokenize(text string) []string {
+	var tokens []string
+	for _, word := range strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return unicode.IsSpace(r) || r == ',' || r == '/' || r == '(' || r == ')'
+	}) {
+		var parts []string
+		var current []rune
+		for _, r := range word {
+			if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+				parts, current = appendPart(parts, current), nil
+				continue
+			}
+			if len(current) > 0 && unicode.IsDigit(r) != unicode.IsDigit(current[len(current)-1]) {
+				parts, current = appendPart(parts, current), nil
+			}
+			current = append(current, r)
+		}
+		parts = appendPart(parts, current)
+		tokens = append(tokens, parts...)
+		if len(parts) > 1 {
+			tokens = append(tokens, strings.Join(parts, ""))
+		}
+	}
+	return tokens
+}
+
+// initials abbreviates text the way drivetrains usually are, so
+// "All-Wheel Drive" can be found as "awd".
+func initials(text string) string {
+	var b strings.Builder
+	for _, word := range strings.FieldsFunc(text, func(r rune) bool { return r == ' ' || r == '-' }) {
+		// The first rune, not the first byte, so "Über" starts with "ü"
+		first, _ := utf8.DecodeRuneInString(word)
+		b.WriteRune(unicode.ToLower(first))
+	}
+	return b.String()
+}
+
+func appendPart(parts []string, part []rune) []string {
+	if len(part) == 0 {
+		return parts
+	}
+	return append(parts, string(part))
+}
+
+// maxTypos is how many edits a query term of this length may be away from
+// an indexed term. Short terms must match exactly.
+func maxTypos(term string) int {
+	switch n := len([]rune(term)); {
+	case n < 4:
+		return 0
+	case n < 8:
+		return 1
+	}
+	return 2
+}
+
+// matchTerm returns the indexed terms that match a query term, with how well
+// they match. Prefix matches are only tried when prefix is set.
+func (idx *searchIndex) matchTerm(term string, prefix bool) map[string]float64 {
+	matches := map[string]float64{}
+	if _, ok := idx.postings[term]; ok {
+		matches[term] = scoreExact
+	}
+	if prefix {
+		for i := sort.SearchStrings(idx.terms, term); i < len(idx.terms) && strings.HasPrefix(idx.terms[i], term); i++ {
+			if _, ok := matches[idx.terms[i]]; !ok {
+				matches[idx.terms[i]] = scorePrefix
+			}
+		}
+	}
+	if typos := maxTypos(term); typos > 0 {
+		for _, candidate := range idx.terms {
+			if _, ok := matches[candidate]; ok {
+				continue
+			}
+			if d := editDistance(term, candidate, typos); d <= typos {
+				matches[candidate] = scoreTypo / float64(d)
+			}
+		}
+	}
+	return matches
+}
+
+// search ranks car models by how well they match query. Every query term
+// adds the score of its best match in a car, and cars matching only some
+// terms are ranked below cars matching all of them. The last term also
+// matches as a prefix, so results update while typing.
+func (idx *searchIndex) search(query string) []searchHit {
+	terms := tokenize(query)
+	if len(terms) == 0 {
+		return []searchHit{}
+	}
+
+	scores := map[int]float64{}
+	matched := map[int]int{}
+	for i, term := range terms {
+		best := map[int]float64{}
+		for indexed, quality := range idx.matchTerm(term, i == len(terms)-1) {
+			for _, p := range idx.postings[indexed] {
+				if s := quality * p.weight; s > best[p.id] {
+					best[p.id] = s
+				}
+			}
+		}
+		for id, s := range best {
+			scores[id] += s
+			matched[id]++
+		}
+	}
+
+	hits := []searchHit{}
+	for _, id := range idx.order {
+		if score, ok := scores[id]; ok {
+			coverage := float64(matched[id]) / float64(len(terms))
+			score *= coverage * coverage
+			hits = append(hits, searchHit{CarModel: idx.models[id], Score: float64(int(score*1000+0.5)) / 1000})
+		}
+	}
+	sort.SliceStable(hits, func(i, j int) bool { return hits[i].Score > hits[j].Score })
+	return hits
+}
+
+// suggest completes a partly typed query with manufacturer and car model
+// names, best matches first.
+func (idx *searchIndex) suggest(query string) []suggestion {
+	out := []suggestion{}
+	terms := tokenize(query)
+	if len(terms) == 0 {
+		return out
+	}
+
+	// A manufacturer whose name starts with the query comes first.
+	q := strings.ToLower(strings.TrimSpace(query))
+	var makers []Manufacturer
+	for _, m := range idx.makers {
+		if strings.HasPrefix(strings.ToLower(m.Name), q) {
+			makers = append(makers, m)
+		}
+	}
+	sort.Slice(makers, func(i, j int) bool { return makers[i].Name < makers[j].Name })
+	for _, m := range makers {
+		out = append(out, suggestion{Text: m.Name, Type: "manufacturer", ID: m.ID})
+	}
+
+	for _, hit := range idx.search(query) {
+		if len(out) >= maxSuggestions {
+			break
+		}
+		out = append(out, suggestion{Text: hit.Name, Type: "carModel", ID: hit.ID})
+	}
+	if len(out) > maxSuggestions {
+		out = out[:maxSuggestions]
+	}
+	return out
+}
+
+// editDistance returns the optimal string alignment distance between a and
+// b, counting a swap of two neighbouring letters as one edit. It stops early
+// and returns max+1 once the distance is known to exceed max.
+func editDistance(a, b string, max int) int {
+	ra, rb := []rune(a), []rune(b)
+	if diff := len(ra) - len(rb); diff > max || -diff > max {
+		return max + 1
+	}
+	prev2 := make([]int, len(rb)+1)
+	prev := make([]int, len(rb)+1)
+	cur := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		cur[0] = i
+		rowMin := cur[0]
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			cur[j] = minInt(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+			if i > 1 && j > 1 && ra[i-1] == rb[j-2] && ra[i-2] == rb[j-1] {
+				cur[j] = minInt(cur[j], prev2[j-2]+1)
+			}
+			if cur[j] < rowMin {
+				rowMin = cur[j]
+			}
+		}
+		if rowMin > max {
+			return max + 1
+		}
+		prev2, prev, cur = prev, cur, prev2
+	}
+	return prev[len(rb)]
+}
+
+func minInt(first int, rest ...int) int {
+	for _, v := range rest {
+		if v < first {
+			first = v
+		}
+	}
+	return first
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestInitials(t *testing.T) {
+	tests := []struct {
+		text, want string
+	}{
+		{"All-Wheel Drive", "awd"},
+		{"Front-Wheel Drive", "fwd"},
+		{"rear wheel  drive", "rwd"},
+		{"4x4", "4"},
+		{"", ""},
+		{"Über Wagen", "üw"},
+		{"Élan-Ürus", "éü"},
+	}
+	for _, tt := range tests {
+		if got := initials(tt.text); got != tt.want {
+			t.Errorf("initials(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestMatchTerm(t *testing.T) {
+	idx := buildIndex(1,
+		[]Manufacturer{{ID: 1, Name: "Honda", Country: "Japan"}},
+		[]Category{{ID: 1, Name: "Hatchback"}},
+		[]CarModel{{ID: 1, Name: "Civic Type R", ManufacturerID: 1, CategoryID: 1, Year: 2023}},
+	)
+	tests := []struct {
+		term   string
+		prefix bool
+		want   map[string]float64
+	}{
+		{"civic", false, map[string]float64{"civic": scoreExact}},
+		{"civ", true, map[string]float64{"civic": scorePrefix}},
+		{"civ", false, map[string]float64{}},
+		{"civc", false, map[string]float64{"civic": scoreTypo}},
+		{"hatchbak", false, map[string]float64{"hatchback": scoreTypo}},
+		{"hatchbk", false, map[string]float64{}},
+		{"hatchbk", true, map[string]float64{}},
+		{"hetchbakk", false, map[string]float64{"hatchback": scoreTypo / 2}},
+		{"ja", true, map[string]float64{"japan": scorePrefix}},
+		{"r", false, map[string]float64{"r": scoreExact}},
+		{"type", true, map[string]float64{"type": scoreExact}},
+		{"202", true, map[string]float64{"2023": scorePrefix}},
+	}
+	for _, tt := range tests {
+		if got := idx.matchTerm(tt.term, tt.prefix); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("matchTerm(%q, %v) = %v, want %v", tt.term, tt.prefix, got, tt.want)
+		}
+	}
+}
@@ -2,20 +2,13 @@ package main
 
 import (
 	"encoding/json"
-	"fmt"
 	"log"
 	"net/http"
 	"strconv"
-	"strings"
 )
 
 func manufacturersHandler(w http.ResponseWriter, r *http.Request) {
-	var manufacturers []Manufacturer
-	err := fetchAPI("manufacturers", &manufacturers)
-	if err != nil {
-		http.Error(w, "Failed to fetch manufacturers data", http.StatusInternalServerError)
-		return
-	}
+	manufacturers, _, _ := snapshot()
 
 	jsonResponse, err := json.Marshal(manufacturers)
 	if err != nil {
@@ -28,12 +21,7 @@ func manufacturersHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 func categoriesHandler(w http.ResponseWriter, r *http.Request) {
-	var categories []Category
-	err := fetchAPI("categories", &categories)
-	if err != nil {
-		http.Error(w, "Failed to fetch categories data", http.StatusInternalServerError)
-		return
-	}
+	_, categories, _ := snapshot()
 
 	jsonResponse, err := json.Marshal(categories)
 	if err != nil {
@@ -46,12 +34,7 @@ func categoriesHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 func carModelsHandler(w http.ResponseWriter, r *http.Request) {
-	var carModels []CarModel
-	err := fetchAPI("carModels", &carModels)
-	if err != nil {
-		http.Error(w, "Failed to fetch car models data", http.StatusInternalServerError)
-		return
-	}
+	_, _, carModels := snapshot()
 
 	jsonResponse, err := json.Marshal(carModels)
 	if err != nil {
@@ -71,10 +54,9 @@ func getManufacturerByIDHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var manufacturer Manufacturer
-	err = fetchAPI(fmt.Sprintf("manufacturers/%d", id), &manufacturer)
-	if err != nil {
-		http.Error(w, "Failed to fetch manufacturer data", http.StatusInternalServerError)
+	manufacturer := getManufacturerByID(id)
+	if manufacturer == nil {
+		http.NotFound(w, r)
 		return
 	}
 
@@ -89,28 +71,14 @@ func getManufacturerByIDHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 func searchCarModels(w http.ResponseWriter, r *http.Request) {
-	query := r.URL.Query()
-	searchName := query.Get("name")
-	searchManufacturer := query.Get("manufacturer")
-	searchCategory := query.Get("category")
-
-	var results []CarModel
-	err := fetchAPI("carModels", &results)
+	query, err := parseCarQuery(r.URL.Query())
 	if err != nil {
-		http.Error(w, "Failed to fetch car models data", http.StatusInternalServerError)
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	var filteredResults []CarModel
-	for _, model := range results {
-		if (searchName == "" || strings.Contains(strings.ToLower(model.Name), strings.ToLower(searchName))) &&
-			(searchManufacturer == "" || strconv.Itoa(model.ManufacturerID) == searchManufacturer) &&
-			(searchCategory == "" || strconv.Itoa(model.CategoryID) == searchCategory) {
-			filteredResults = append(filteredResults, model)
-		}
-	}
-
-	jsonResponse, err := json.Marshal(filteredResults)
+	manufacturers, _, carModels := snapshot()
+	jsonResponse, err := json.Marshal(query.run(manufacturers, carModels))
 	if err != nil {
 		http.Error(w, "Failed to marshal search results", http.StatusInternalServerError)
 		return
@@ -128,14 +96,7 @@ func carModelDetailHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var foundModel *CarModel
-	for _, model := range data.CarModels {
-		if model.ID == id {
-			foundModel = &model
-			break
-		}
-	}
-
+	foundModel := getCarModelByID(id)
 	if foundModel == nil {
 		http.NotFound(w, r)
 		return
@@ -160,141 +121,70 @@ func carModelDetailHandler(w http.ResponseWriter, r *http.Request) {
 	w.Write(jsonResponse)
 }
 
-func compareCarModelsHandler(w http.ResponseWriter, r *http.Request) {
-	ids := r.URL.Query()["ids"]
-	var results []CarModel
-
-	for _, idStr := range ids {
-		id, err := strconv.Atoi(idStr)
-		if err != nil {
-			http.Error(w, "Invalid car model ID", http.StatusBadRequest)
-			return
-		}
-
-		var model CarModel
-		err = fetchAPI(fmt.Sprintf("carModels/%d", id), &model)
-		if err != nil {
-			http.Error(w, "Failed to fetch car model data", http.StatusInternalServerError)
-			return
-		}
-
-		results = append(results, model)
-	}
-
-	if len(results) == 0 {
-		http.NotFound(w, r)
-		return
-	}
-
-	jsonResponse, err := json.Marshal(results)
-	if err != nil {
-		http.Error(w, "Failed to marshal comparison data", http.StatusInternalServerError)
-		return
-	}
-
-	w.Header().Set("Content-Type", "application/json")
-	w.Write(jsonResponse)
-}
-
+// personalizedRecommendationsHandler suggests cars based on what the user
+// has viewed, compared and liked.
 func personalizedRecommendationsHandler(w http.ResponseWriter, r *http.Request) {
-	recommendations := getRecentViewedCars()
-	log.Println("Generated recommendations:", recommendations)
-
-	if len(recommendations) == 0 {
-		log.Println("No recommendations available")
-		http.Error(w, "No recommendations available", http.StatusInternalServerError)
+	n, err := recommendationCount(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
+	weights, kinds := tasteOf(r)
+	recommendations := recommend(weights, kinds, n)
 
 	w.Header().Set("Content-Type", "application/json")
-	err := json.NewEncoder(w).Encode(recommendations)
+	err = json.NewEncoder(w).Encode(recommendations)
 	if err != nil {
 		log.Println("Failed to encode recommendations:", err)
 		http.Error(w, "Failed to encode recommendations", http.StatusInternalServerError)
 	}
 }
 
-func getRecentViewedCars() []CarModel {
-	var recentCars []CarModel
-	for _, carID := range data.RecommendedIDs {
-		for _, car := range data.CarModels {
-			if car.ID == carID {
-				recentCars = append(recentCars, car)
-				break
-			}
-		}
-	}
-	log.Println("Recent viewed cars:", recentCars)
-	return recentCars
-}
-
 func trackInteractionHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
 	if err := r.ParseForm(); err != nil {
 		http.Error(w, "Failed to parse form data", http.StatusBadRequest)
 		return
 	}
 
-	carModelIDStr := r.FormValue("car_model_id")
+	// Only the body counts, so a link or image cannot record a view
+	carModelIDStr := r.PostFormValue("car_model_id")
 	carModelID, err := strconv.Atoi(carModelIDStr)
 	if err != nil {
 		http.Error(w, "Invalid car model ID", http.StatusBadRequest)
 		return
 	}
+	if getCarModelByID(carModelID) == nil {
+		http.Error(w, "Car model not found", http.StatusNotFound)
+		return
+	}
 
-	trackUserInteraction(carModelID)
-	log.Println("Tracked interaction:", carModelID)
-	log.Println("Current user interactions (RecommendedIDs):", data.RecommendedIDs)
+	recordInteraction(w, r, interactionView, carModelID)
 
 	http.Redirect(w, r, "/recommendations.html", http.StatusSeeOther)
 }
 
-func trackUserInteraction(carModelID int) {
-	for _, id := range data.RecommendedIDs {
-		if id == carModelID {
-			return
-		}
-	}
-	data.RecommendedIDs = append(data.RecommendedIDs, carModelID)
-	if len(data.RecommendedIDs) > 3 {
-		data.RecommendedIDs = data.RecommendedIDs[1:]
-	}
-	log.Println("Updated RecommendedIDs:", data.RecommendedIDs)
-}
-
-func getManufacturerName(id int) string {
-	var manufacturer Manufacturer
-	err := fetchAPI(fmt.Sprintf("manufacturers/%d", id), &manufacturer)
-	if err != nil {
-		return ""
-	}
-	return manufacturer.Name
-}
-
+// searchHandler ranks car models for the "q" parameter. With
+// mode=autocomplete it returns name suggestions instead.
 func searchHandler(w http.ResponseWriter, r *http.Request) {
 	query := r.URL.Query().Get("q")
-	results := searchDatabase(query)
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(results)
-}
-
-func searchDatabase(query string) []CarModel {
-	var results []CarModel
-	lowerQuery := strings.ToLower(query)
-	var carModels []CarModel
-	err := fetchAPI("carModels", &carModels)
-	if err != nil {
-		log.Printf("Error fetching car models: %v", err)
-		return results
-	}
+	idx := currentIndex()
 
-	for _, car := range carModels {
-		if strings.Contains(strings.ToLower(car.Name), lowerQuery) ||
-			strings.Contains(strings.ToLower(getManufacturerName(car.ManufacturerID)), lowerQuery) ||
-			strings.Contains(fmt.Sprint(car.Year), lowerQuery) {
-			results = append(results, car)
-		}
+	var results interface{}
+	switch r.URL.Query().Get("mode") {
+	case "":
+		results = idx.search(query)
+	case "autocomplete":
+		results = idx.suggest(query)
+	default:
+		http.Error(w, "Invalid search mode", http.StatusBadRequest)
+		return
 	}
-	return results
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(results)
 }
 
 func ErrorHandler(f http.HandlerFunc) http.HandlerFunc {
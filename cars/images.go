@@ -0,0 +1,266 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	_ "image/gif"
+	"image/jpeg"
+	_ "image/png"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Where images live on disk and the URL they are served from.
+const (
+	imagesDir        = "static/images"
+	uploadsDir       = "static/images/uploads"
+	imagesURL        = "/static/images/"
+	placeholderImage = "/static/images/placeholder.svg"
+)
+
+// Limits and sizes for uploaded images.
+const (
+	maxImageUpload = 10 << 20
+	maxImagePixels = 40_000_000
+	jpegQuality    = 85
+)
+
+// imageVariants are the widths every upload is stored in. The largest is
+// used as the model's image.
+var imageVariants = []struct {
+	suffix string
+	width  int
+}{
+	{"", 1200},
+	{"_640", 640},
+	{"_240", 240},
+}
+
+// thumbnailSuffix picks the variant shown in listings.
+const thumbnailSuffix = "_640"
+
+var (
+	errUnsupportedImage = errors.New("image must be a JPEG, PNG or GIF")
+	errImageTooLarge    = errors.New("image has too many pixels")
+)
+
+// carModelImageHandler stores an uploaded image for a car model, together
+// with smaller variants for listings. It expects a multipart "image" file.
+func carModelImageHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+	id, err := strconv.Atoi(r.URL.Query().Get("id"))
+	if err != nil {
+		http.Error(w, "Invalid car model ID", http.StatusBadRequest)
+		return
+	}
+	if getCarModelByID(id) == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxImageUpload)
+	file, _, err := r.FormFile("image")
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			http.Error(w, "Image too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+		http.Error(w, "Missing image file", http.StatusBadRequest)
+		return
+	}
+	defer file.Close()
+	content, err := io.ReadAll(file)
+	if err != nil {
+		http.Error(w, "Failed to read image", http.StatusBadRequest)
+		return
+	}
+
+	img, err := decodeUpload(content)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	sum := sha256.Sum256(content)
+	base := fmt.Sprintf("%d-%s", id, hex.EncodeToString(sum[:4]))
+	if err := writeVariants(img, base); err != nil {
+		log.Printf("Failed to store image for car model %d: %v", id, err)
+		http.Error(w, "Failed to store image", http.StatusInternalServerError)
+		return
+	}
+
+	dataMutex.Lock()
+	var updated CarModel
+	var old string
+	c := current()
+	c.CarModels = append([]CarModel{}, data.CarModels...)
+	for i := range c.CarModels {
+		if c.CarModels[i].ID == id {
+			old = c.CarModels[i].Image
+			c.CarModels[i].Image = imagesURL + "uploads/" + base + ".jpg"
+			c.CarModels[i].Thumbnail = imagesURL + "uploads/" + base + thumbnailSuffix + ".jpg"
+			updated = c.CarModels[i]
+		}
+	}
+	err = commit(c)
+	dataMutex.Unlock()
+	if err != nil {
+		log.Printf("Failed to save data: %v", err)
+		http.Error(w, "Failed to save image", http.StatusInternalServerError)
+		return
+	}
+	if updated.ID == 0 {
+		// Deleted while the upload was processed
+		http.NotFound(w, r)
+		return
+	}
+	if old != updated.Image {
+		removeUpload(old)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(updated)
+}
+
+// decodeUpload checks the file type by its content and the pixel count
+// before decoding the whole image.
+func decodeUpload(content []byte) (image.Image, error) {
+	switch http.DetectContentType(content) {
+	case "image/jpeg", "image/png", "image/gif":
+	default:
+		return nil, errUnsupportedImage
+	}
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(content))
+	if err != nil {
+		return nil, errUnsupportedImage
+	}
+	if cfg.Width*cfg.Height > maxImagePixels {
+		return nil, errImageTooLarge
+	}
+	img, _, err := image.Decode(bytes.NewReader(content))
+	if err != nil {
+		return nil, errUnsupportedImage
+	}
+	return img, nil
+}
+
+// writeVariants saves img as JPEG at every width in imageVariants. Images are
+// never scaled up.
+func writeVariants(img image.Image, base string) error {
+	if err := os.MkdirAll(uploadsDir, 0o755); err != nil {
+		return err
+	}
+	src := flatten(img)
+	for _, v := range imageVariants {
+		var buf bytes.Buffer
+		if err := jpeg.Encode(&buf, resize(src, v.width), &jpeg.Options{Quality: jpegQuality}); err != nil {
+			return err
+		}
+		if err := os.WriteFile(filepath.Join(uploadsDir, base+v.suffix+".jpg"), buf.Bytes(), 0o644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// removeUpload deletes the stored variants of an earlier upload. Images that
+// were not uploaded are left alone.
+func removeUpload(image string) {
+	if !isUpload(image) {
+		return
+	}
+	base := strings.TrimSuffix(filepath.Base(image), ".jpg")
+	for _, v := range imageVariants {
+		os.Remove(filepath.Join(uploadsDir, base+v.suffix+".jpg"))
+	}
+}
+
+// isUpload reports whether image is the URL of an uploaded image.
+func isUpload(image string) bool {
+	return strings.HasPrefix(image, imagesURL+"uploads/")
+}
+
+// flatten draws img onto a white RGBA image with its origin at 0,0.
+// Transparent areas end up white, since JPEG has no alpha channel.
+func flatten(img image.Image) *image.RGBA {
+	b := img.Bounds()
+	flat := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(flat, flat.Bounds(), image.White, image.Point{}, draw.Src)
+	draw.Draw(flat, flat.Bounds(), img, b.Min, draw.Over)
+	return flat
+}
+
+// resize scales src, as returned by flatten, down to width, keeping its
+// aspect ratio. Each output pixel is the average of the source pixels it
+// covers.
+func resize(src *image.RGBA, width int) image.Image {
+	b := src.Bounds()
+	if b.Dx() <= width {
+		return src
+	}
+
+	height := b.Dy() * width / b.Dx()
+	if height < 1 {
+		height = 1
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		y0, y1 := y*b.Dy()/height, (y+1)*b.Dy()/height
+		if y1 == y0 {
+			y1++
+		}
+		for x := 0; x < width; x++ {
+			x0, x1 := x*b.Dx()/width, (x+1)*b.Dx()/width
+			if x1 == x0 {
+				x1++
+			}
+			var r, g, bl, n int
+			for sy := y0; sy < y1; sy++ {
+				row := src.Pix[sy*src.Stride:]
+				for sx := x0; sx < x1; sx++ {
+					r += int(row[sx*4])
+					g += int(row[sx*4+1])
+					bl += int(row[sx*4+2])
+					n++
+				}
+			}
+			i := y*dst.Stride + x*4
+			dst.Pix[i] = uint8(r / n)
+			dst.Pix[i+1] = uint8(g / n)
+			dst.Pix[i+2] = uint8(bl / n)
+			dst.Pix[i+3] = 255
+		}
+	}
+	return dst
+}
+
+// imageFileServer serves car images and falls back to the placeholder for
+// images that do not exist.
+func imageFileServer(fs http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "images/") {
+			name := filepath.Join(imagesDir, filepath.FromSlash(strings.TrimPrefix(r.URL.Path, "images/")))
+			if _, err := os.Stat(name); errors.Is(err, os.ErrNotExist) {
+				w.Header().Set("Cache-Control", "no-cache")
+				http.ServeFile(w, r, "."+placeholderImage)
+				return
+			}
+		}
+		fs.ServeHTTP(w, r)
+	})
+}
@@ -2,98 +2,74 @@ package main
 
 import (
 	"encoding/json"
-	"fmt"
 	"log"
 	"net/http"
 	"strconv"
-	"sync"
+	"time"
 )
 
-type User struct {
-	LikedCars []int
-}
-
-var users = make(map[string]*User)
-var usersMutex sync.Mutex
-
-func likeCarHandler(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
+// likeCarHandler likes a car with PUT and unlikes it with DELETE. Both can be
+// repeated safely.
+func likeCarHandler(w http.ResponseWriter, r *http.Request, username string) {
+	if r.Method != http.MethodPut && r.Method != http.MethodDelete {
 		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
 		return
 	}
 
-	userID := r.Header.Get("User-ID")
-	if userID == "" {
-		http.Error(w, "User ID required", http.StatusBadRequest)
-		return
-	}
-
 	carModelIDStr := r.URL.Query().Get("car_model_id")
 	carModelID, err := strconv.Atoi(carModelIDStr)
 	if err != nil {
 		http.Error(w, "Invalid car model ID", http.StatusBadRequest)
 		return
 	}
-
-	usersMutex.Lock()
-	defer usersMutex.Unlock()
-
-	user, exists := users[userID]
-	if !exists {
-		user = &User{}
-		users[userID] = user
+	like := r.Method == http.MethodPut
+	if like && getCarModelByID(carModelID) == nil {
+		http.Error(w, "Car model not found", http.StatusNotFound)
+		return
 	}
 
-	log.Printf("Received like/unlike request for user ID: %s, car ID: %d", userID, carModelID)
+	accountsMutex.Lock()
+	defer accountsMutex.Unlock()
+	account := accounts.Accounts[username]
 
-	isLiked := false
-	for _, id := range user.LikedCars {
+	index := -1
+	for i, id := range account.LikedCars {
 		if id == carModelID {
-			isLiked = true
+			index = i
 			break
 		}
 	}
 
-	if isLiked {
-		// unlike the car
-		for i, id := range user.LikedCars {
-			if id == carModelID {
-				user.LikedCars = append(user.LikedCars[:i], user.LikedCars[i+1:]...)
-				break
-			}
-		}
-		log.Printf("Unliked car ID: %d for user ID: %s", carModelID, userID)
-	} else {
-		// like the car
-		user.LikedCars = append(user.LikedCars, carModelID)
-		log.Printf("Liked car ID: %d for user ID: %s", carModelID, userID)
-	}
-
-	w.WriteHeader(http.StatusOK)
-}
-
-func likedCarsHandler(w http.ResponseWriter, r *http.Request) {
-	userID := r.Header.Get("User-ID")
-	if userID == "" {
-		http.Error(w, "User ID required", http.StatusBadRequest)
+	switch {
+	case like && index < 0:
+		account.LikedCars = append(account.LikedCars, carModelID)
+		account.History = appendHistory(account.History, interaction{CarID: carModelID, Kind: interactionLike, At: time.Now()})
+		log.Printf("Liked car ID: %d for user: %s", carModelID, username)
+	case !like && index >= 0:
+		account.LikedCars = append(account.LikedCars[:index], account.LikedCars[index+1:]...)
+		log.Printf("Unliked car ID: %d for user: %s", carModelID, username)
+	default:
+		w.WriteHeader(http.StatusNoContent)
 		return
 	}
 
-	usersMutex.Lock()
-	user, exists := users[userID]
-	usersMutex.Unlock()
-
-	if !exists {
-		http.Error(w, "User not found", http.StatusNotFound)
+	if err := saveAccounts(); err != nil {
+		log.Printf("Failed to save likes: %v", err)
+		http.Error(w, "Failed to save like", http.StatusInternalServerError)
 		return
 	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func likedCarsHandler(w http.ResponseWriter, r *http.Request, username string) {
+	accountsMutex.Lock()
+	liked := append([]int{}, accounts.Accounts[username].LikedCars...)
+	accountsMutex.Unlock()
 
-	var likedCarModels []CarModel
-	for _, carID := range user.LikedCars {
-		var car CarModel
-		err := fetchAPI(fmt.Sprintf("carModels/%d", carID), &car)
-		if err == nil {
-			likedCarModels = append(likedCarModels, car)
+	likedCarModels := []CarModel{}
+	for _, carID := range liked {
+		if car := getCarModelByID(carID); car != nil {
+			likedCarModels = append(likedCarModels, *car)
 		}
 	}
 
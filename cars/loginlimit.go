@@ -0,0 +1,96 @@
+package main
+
+import (
+	"net"
+	"net/http"
+	"runtime"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Limits on password hashing, which takes a lot of CPU on purpose.
+const (
+	// maxLoginAttempts is how many logins and registrations one address may
+	// try per loginWindow.
+	maxLoginAttempts = 10
+	loginWindow      = time.Minute
+	// hashWait is how long a request waits for a free hashing slot.
+	hashWait = 5 * time.Second
+	// maxTrackedAddresses bounds the attempt counters kept in memory.
+	maxTrackedAddresses = 10000
+)
+
+// hashSlots lets at most one password hash per CPU run at a time, so a burst
+// of logins queues up instead of starving every other request.
+var hashSlots = make(chan struct{}, runtime.NumCPU())
+
+// attempts counts the logins from one address in the current window.
+type attempts struct {
+	count int
+	start time.Time
+}
+
+var (
+	loginAttempts      = map[string]*attempts{}
+	loginAttemptsMutex sync.Mutex
+)
+
+// allowLogin counts an attempt from the client's address and reports whether
+// it is within maxLoginAttempts per loginWindow. If not, it answers 429.
+func allowLogin(w http.ResponseWriter, r *http.Request) bool {
+	// RemoteAddr, not X-Forwarded-For, which the client could make up
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	now := time.Now()
+
+	loginAttemptsMutex.Lock()
+	defer loginAttemptsMutex.Unlock()
+	a, ok := loginAttempts[host]
+	if !ok || now.Sub(a.start) >= loginWindow {
+		if !ok && len(loginAttempts) >= maxTrackedAddresses {
+			forgetOldAttempts(now)
+		}
+		a = &attempts{start: now}
+		loginAttempts[host] = a
+	}
+	a.count++
+	if a.count > maxLoginAttempts {
+		retry := a.start.Add(loginWindow).Sub(now)
+		w.Header().Set("Retry-After", strconv.Itoa(int(retry.Seconds())+1))
+		http.Error(w, "Too many attempts, try again later", http.StatusTooManyRequests)
+		return false
+	}
+	return true
+}
+
+// forgetOldAttempts drops counters whose window is over. The caller must hold
+// loginAttemptsMutex.
+func forgetOldAttempts(now time.Time) {
+	for host, a := range loginAttempts {
+		if now.Sub(a.start) >= loginWindow {
+			delete(loginAttempts, host)
+		}
+	}
+}
+
+// withHashSlot runs hash once a hashing slot is free. If none frees up within
+// hashWait, or the client goes away, it answers 503 and returns false.
+func withHashSlot(w http.ResponseWriter, r *http.Request, hash func()) bool {
+	timer := time.NewTimer(hashWait)
+	defer timer.Stop()
+	select {
+	case hashSlots <- struct{}{}:
+	case <-timer.C:
+		w.Header().Set("Retry-After", "1")
+		http.Error(w, "Server is busy, try again shortly", http.StatusServiceUnavailable)
+		return false
+	case <-r.Context().Done():
+		return false
+	}
+	defer func() { <-hashSlots }()
+	hash()
+	return true
+}
@@ -1,29 +1,73 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
 	"strings"
+	"syscall"
+	"time"
 )
 
 func main() {
 	loadData()
+	startImportSync()
+	loadAccounts()
+	startHistoryFlusher()
 	setupStaticFileServing()
 	setupRouteHandlers()
+	setupAdminHandlers()
 
-	port := ":8081"
+	port := listenAddr()
+	if os.Getenv("CARS_SITE_URL") == "" {
+		log.Printf("CARS_SITE_URL is not set, page links will point to %s", siteURL())
+	}
+	server := &http.Server{Addr: port}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	serveErr := make(chan error, 1)
+	go func() {
+		fmt.Printf("Server is running on http://localhost%s\n", port)
+		serveErr <- server.ListenAndServe()
+	}()
+
+	select {
+	case err := <-serveErr:
+		log.Fatal(err)
+	case <-ctx.Done():
+	}
+
+	// Let requests in flight finish, then save the history they recorded.
+	log.Println("Shutting down")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		log.Printf("Shutdown did not finish cleanly: %v", err)
+	}
+	flushHistory()
+}
+
+// shutdownTimeout is how long requests in flight get to finish when the
+// server is stopped.
+const shutdownTimeout = 10 * time.Second
+
+// listenAddr is the address the server listens on, port 8081 unless PORT
+// is set.
+func listenAddr() string {
 	if p := os.Getenv("PORT"); p != "" {
-		port = ":" + p
+		return ":" + p
 	}
-	fmt.Printf("Server is running on http://localhost%s\n", port)
-	log.Fatal(http.ListenAndServe(port, nil))
+	return ":8081"
 }
 
 func setupStaticFileServing() {
 	fs := http.FileServer(http.Dir("./static"))
-	http.Handle("/static/", http.StripPrefix("/static/", fs))
+	http.Handle("/static/", http.StripPrefix("/static/", imageFileServer(fs)))
 }
 
 func setupRouteHandlers() {
@@ -32,6 +76,9 @@ func setupRouteHandlers() {
 		if r.URL.Path == "/" || r.URL.Path == "/index.html" {
 			log.Println("Serving index.html")
 			http.ServeFile(w, r, "./static/index.html")
+		} else if r.URL.Path == "/login.html" {
+			log.Println("Serving login.html")
+			http.ServeFile(w, r, "./static/login.html")
 		} else if r.URL.Path == "/details.html" {
 			log.Println("Serving details.html")
 			http.ServeFile(w, r, "./static/details.html")
@@ -50,8 +97,12 @@ func setupRouteHandlers() {
 	http.HandleFunc("/searchCarModels", searchCarModels)
 	http.HandleFunc("/search", searchHandler)
 
-	http.HandleFunc("/likeCar", likeCarHandler)
-	http.HandleFunc("/likedCars", likedCarsHandler)
+	http.HandleFunc("/register", registerHandler)
+	http.HandleFunc("/login", loginHandler)
+	http.HandleFunc("/logout", logoutHandler)
+	http.HandleFunc("/me", requireLogin(meHandler))
+	http.HandleFunc("/likeCar", requireLogin(likeCarHandler))
+	http.HandleFunc("/likedCars", requireLogin(likedCarsHandler))
 	http.HandleFunc("/track-interaction", trackInteractionHandler)
 	http.HandleFunc("/recommendations", personalizedRecommendationsHandler)
 
@@ -59,6 +110,11 @@ func setupRouteHandlers() {
 	http.HandleFunc("/categories", categoriesHandler)
 	http.HandleFunc("/manufacturer", getManufacturerByIDHandler)
 
+	http.HandleFunc("/cars/", carPageHandler)
+	http.HandleFunc("/manufacturers/", manufacturerPageHandler)
+	http.HandleFunc("/categories/", categoryPageHandler)
+	http.HandleFunc("/sitemap.xml", sitemapHandler)
+
 	http.HandleFunc("/recommendations.html", func(w http.ResponseWriter, r *http.Request) {
 		log.Println("Serving recommendations.html")
 		http.ServeFile(w, r, "./static/recommendations.html")
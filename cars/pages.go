@@ -0,0 +1,340 @@
+package main
+
+import (
+	"bytes"
+	"embed"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// templateFiles are the server rendered pages. Each page defines "content"
+// and is drawn inside "layout".
+//
+//go:embed templates/*.html
+var templateFiles embed.FS
+
+const siteName = "WowCar.ee"
+
+var pageTemplates = map[string]*template.Template{
+	"car":          parsePage("car.html"),
+	"manufacturer": parsePage("manufacturer.html"),
+	"category":     parsePage("category.html"),
+}
+
+func parsePage(name string) *template.Template {
+	return template.Must(template.ParseFS(templateFiles, "templates/layout.html", "templates/"+name))
+}
+
+// page is what the layout needs to fill in the title and the metadata for
+// search engines and link previews. Data is passed on to the page itself.
+type page struct {
+	SiteName       string
+	Title          string
+	Description    string
+	Type           string
+	URL            string
+	Image          string
+	StructuredData template.JS
+	Data           interface{}
+}
+
+// siteURL is the address the site is reached at, without a trailing slash.
+// It is taken from CARS_SITE_URL, or is the local address the server listens
+// on. The Host header is never used: anyone can send any host, and the links
+// end up in shared caches and search engines.
+func siteURL() string {
+	if u := os.Getenv("CARS_SITE_URL"); u != "" {
+		return strings.TrimSuffix(u, "/")
+	}
+	return "http://localhost" + listenAddr()
+}
+
+// absoluteURL prefixes a path with the site's address. Images imported from
+// elsewhere may already be full URLs.
+func absoluteURL(base, path string) string {
+	if strings.HasPrefix(path, "http://") || strings.HasPrefix(path, "https://") {
+		return path
+	}
+	return base + path
+}
+
+// pageID reads the ID at the end of a path such as /cars/3.
+func pageID(r *http.Request, prefix string) (int, bool) {
+	id, err := strconv.Atoi(strings.TrimPrefix(r.URL.Path, prefix))
+	return id, err == nil
+}
+
+// renderPage draws the page into a buffer first, so a template error gives a
+// clean 500 instead of half a page.
+func renderPage(w http.ResponseWriter, name string, p page, structuredData interface{}) {
+	p.SiteName = siteName
+	ld, err := json.Marshal(structuredData)
+	if err != nil {
+		log.Println("Failed to marshal structured data:", err)
+		http.Error(w, "Failed to render page", http.StatusInternalServerError)
+		return
+	}
+	// json.Marshal escapes <, > and &, so this cannot end the script early
+	p.StructuredData = template.JS(ld)
+
+	var buf bytes.Buffer
+	if err := pageTemplates[name].ExecuteTemplate(&buf, "layout", p); err != nil {
+		log.Println("Failed to render page:", err)
+		http.Error(w, "Failed to render page", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write(buf.Bytes())
+}
+
+// schema.org drive wheel configurations, by parsed drive type.
+var driveWheelConfigurations = map[string]string{
+	driveFWD: "https://schema.org/FrontWheelDriveConfiguration",
+	driveRWD: "https://schema.org/RearWheelDriveConfiguration",
+	driveAWD: "https://schema.org/AllWheelDriveConfiguration",
+	drive4WD: "https://schema.org/FourWheelDriveConfiguration",
+}
+
+// vehicleData describes a car model as a schema.org Vehicle.
+func vehicleData(car CarModel, manufacturer *Manufacturer, category *Category, base string) map[string]interface{} {
+	spec := car.Specifications
+	engine := map[string]interface{}{
+		"@type": "EngineSpecification",
+		"name":  spec.Engine,
+		"enginePower": map[string]interface{}{
+			"@type":    "QuantitativeValue",
+			"value":    spec.Horsepower,
+			"unitCode": "BHP",
+		},
+	}
+	if spec.DisplacementLiters > 0 {
+		engine["engineDisplacement"] = map[string]interface{}{
+			"@type":    "QuantitativeValue",
+			"value":    spec.DisplacementLiters,
+			"unitCode": "LTR",
+		}
+	}
+
+	vehicle := map[string]interface{}{
+		"@context":            "https://schema.org",
+		"@type":               "Vehicle",
+		"name":                car.Name,
+		"url":                 base + "/cars/" + strconv.Itoa(car.ID),
+		"image":               absoluteURL(base, car.Image),
+		"vehicleModelDate":    strconv.Itoa(car.Year),
+		"vehicleEngine":       engine,
+		"vehicleTransmission": spec.Transmission,
+	}
+	if manufacturer != nil {
+		vehicle["brand"] = map[string]interface{}{"@type": "Brand", "name": manufacturer.Name}
+		vehicle["manufacturer"] = map[string]interface{}{
+			"@type": "Organization",
+			"name":  manufacturer.Name,
+			"url":   base + "/manufacturers/" + strconv.Itoa(manufacturer.ID),
+		}
+	}
+	if category != nil {
+		vehicle["bodyType"] = category.Name
+	}
+	if config, ok := driveWheelConfigurations[spec.DriveType]; ok {
+		vehicle["driveWheelConfiguration"] = config
+	}
+	if spec.Gears > 0 {
+		vehicle["numberOfForwardGears"] = spec.Gears
+	}
+	return vehicle
+}
+
+// carListData describes a listing page as a schema.org ItemList of vehicles.
+func carListData(name, url string, cars []CarModel, base string) map[string]interface{} {
+	items := []interface{}{}
+	for i, car := range cars {
+		items = append(items, map[string]interface{}{
+			"@type":    "ListItem",
+			"position": i + 1,
+			"url":      base + "/cars/" + strconv.Itoa(car.ID),
+			"name":     car.Name,
+		})
+	}
+	return map[string]interface{}{
+		"@context":        "https://schema.org",
+		"@type":           "ItemList",
+		"name":            name,
+		"url":             url,
+		"numberOfItems":   len(cars),
+		"itemListElement": items,
+	}
+}
+
+func countModels(n int) string {
+	if n == 1 {
+		return "1 model"
+	}
+	return strconv.Itoa(n) + " models"
+}
+
+// carListImage is the image shown in link previews of a listing page.
+func carListImage(cars []CarModel, base string) string {
+	if len(cars) == 0 {
+		return ""
+	}
+	return absoluteURL(base, cars[0].Image)
+}
+
+func carPageHandler(w http.ResponseWriter, r *http.Request) {
+	id, ok := pageID(r, "/cars/")
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	car := getCarModelByID(id)
+	if car == nil {
+		http.NotFound(w, r)
+		return
+	}
+	manufacturer := getManufacturerByID(car.ManufacturerID)
+	category := getCategoryByID(car.CategoryID)
+
+	var related []CarModel
+	if manufacturer != nil {
+		_, _, models := snapshot()
+		for _, m := range models {
+			if m.ManufacturerID == manufacturer.ID && m.ID != car.ID {
+				related = append(related, m)
+			}
+		}
+	}
+
+	base := siteURL()
+	spec := car.Specifications
+	description := fmt.Sprintf("%d %s with a %s engine making %d hp, %s and %s.",
+		car.Year, car.Name, spec.Engine, spec.Horsepower, spec.Transmission, strings.ToLower(spec.Drivetrain))
+	renderPage(w, "car", page{
+		Title:       fmt.Sprintf("%s (%d)", car.Name, car.Year),
+		Description: description,
+		Type:        "product",
+		URL:         base + "/cars/" + strconv.Itoa(car.ID),
+		Image:       absoluteURL(base, car.Image),
+		Data: struct {
+			Car          *CarModel
+			Manufacturer *Manufacturer
+			Category     *Category
+			Related      []CarModel
+		}{car, manufacturer, category, related},
+	}, vehicleData(*car, manufacturer, category, base))
+}
+
+func manufacturerPageHandler(w http.ResponseWriter, r *http.Request) {
+	id, ok := pageID(r, "/manufacturers/")
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	manufacturer := getManufacturerByID(id)
+	if manufacturer == nil {
+		http.NotFound(w, r)
+		return
+	}
+	var cars []CarModel
+	_, _, models := snapshot()
+	for _, m := range models {
+		if m.ManufacturerID == id {
+			cars = append(cars, m)
+		}
+	}
+
+	base := siteURL()
+	url := base + "/manufacturers/" + strconv.Itoa(id)
+	renderPage(w, "manufacturer", page{
+		Title: manufacturer.Name + " cars",
+		Description: fmt.Sprintf("%s is a car manufacturer from %s, founded in %d. See its %s.",
+			manufacturer.Name, manufacturer.Country, manufacturer.FoundingYear, countModels(len(cars))),
+		Type:  "website",
+		URL:   url,
+		Image: carListImage(cars, base),
+		Data: struct {
+			Manufacturer *Manufacturer
+			Cars         []CarModel
+		}{manufacturer, cars},
+	}, carListData(manufacturer.Name+" cars", url, cars, base))
+}
+
+func categoryPageHandler(w http.ResponseWriter, r *http.Request) {
+	id, ok := pageID(r, "/categories/")
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	category := getCategoryByID(id)
+	if category == nil {
+		http.NotFound(w, r)
+		return
+	}
+	var cars []CarModel
+	_, _, models := snapshot()
+	for _, m := range models {
+		if m.CategoryID == id {
+			cars = append(cars, m)
+		}
+	}
+
+	base := siteURL()
+	url := base + "/categories/" + strconv.Itoa(id)
+	renderPage(w, "category", page{
+		Title:       category.Name + " cars",
+		Description: fmt.Sprintf("Compare %s in the %s category by engine, horsepower, transmission and drivetrain.", countModels(len(cars)), strings.ToLower(category.Name)),
+		Type:        "website",
+		URL:         url,
+		Image:       carListImage(cars, base),
+		Data: struct {
+			Category *Category
+			Cars     []CarModel
+		}{category, cars},
+	}, carListData(category.Name+" cars", url, cars, base))
+}
+
+// sitemapURL is one <url> entry of sitemap.xml.
+type sitemapURL struct {
+	Loc string `xml:"loc"`
+}
+
+type sitemap struct {
+	XMLName xml.Name     `xml:"urlset"`
+	XMLNS   string       `xml:"xmlns,attr"`
+	URLs    []sitemapURL `xml:"url"`
+}
+
+// sitemapHandler lists the home page and every car, manufacturer and
+// category page.
+func sitemapHandler(w http.ResponseWriter, r *http.Request) {
+	base := siteURL()
+	manufacturers, categories, models := snapshot()
+
+	s := sitemap{XMLNS: "http://www.sitemaps.org/schemas/sitemap/0.9"}
+	s.URLs = append(s.URLs, sitemapURL{Loc: base + "/"})
+	for _, m := range models {
+		s.URLs = append(s.URLs, sitemapURL{Loc: base + "/cars/" + strconv.Itoa(m.ID)})
+	}
+	for _, m := range manufacturers {
+		s.URLs = append(s.URLs, sitemapURL{Loc: base + "/manufacturers/" + strconv.Itoa(m.ID)})
+	}
+	for _, c := range categories {
+		s.URLs = append(s.URLs, sitemapURL{Loc: base + "/categories/" + strconv.Itoa(c.ID)})
+	}
+
+	content, err := xml.MarshalIndent(s, "", "  ")
+	if err != nil {
+		http.Error(w, "Failed to marshal sitemap", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+	w.Write([]byte(xml.Header))
+	w.Write(content)
+}
@@ -0,0 +1,342 @@
+package main
+
+import (
+	lru "container/list"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Kinds of interaction, and how much each says about a user's taste.
+const (
+	interactionView    = "view"
+	interactionCompare = "compare"
+	interactionLike    = "like"
+)
+
+var interactionWeights = map[string]float64{
+	interactionView:    1,
+	interactionCompare: 2,
+	interactionLike:    3,
+}
+
+// interaction is one thing a user did with a car.
+type interaction struct {
+	CarID int       `json:"carId"`
+	Kind  string    `json:"kind"`
+	At    time.Time `json:"at"`
+}
+
+const (
+	maxHistory             = 50
+	maxVisitors            = 10000
+	visitorCookie          = "visitor"
+	defaultRecommendations = 3
+	maxRecommendations     = 20
+	// historyHalfLife is how long it takes an interaction to count half.
+	historyHalfLife = 14 * 24 * time.Hour
+)
+
+// visitor is the history of someone who is not logged in. Logged in users
+// keep their history in their account.
+type visitor struct {
+	id      string
+	history []interaction
+}
+
+// visitors finds a visitor's element in visitorOrder, which holds the
+// visitors from the most to the least recently seen, so the one to evict
+// when there are too many is always at the back.
+var (
+	visitors      = map[string]*lru.Element{}
+	visitorOrder  = lru.New()
+	visitorsMutex sync.Mutex
+)
+
+// historyFlushInterval is how often new history of logged in users is
+// written to users.json. Recording an interaction only marks the accounts as
+// changed, so browsing does not rewrite the file on every request.
+const historyFlushInterval = 30 * time.Second
+
+// historyChanged is set when an account's history changed after users.json
+// was last written. It is guarded by accountsMutex.
+var historyChanged bool
+
+// startHistoryFlusher writes changed history every historyFlushInterval.
+// main flushes once more after the server has shut down.
+func startHistoryFlusher() {
+	go func() {
+		for range time.Tick(historyFlushInterval) {
+			flushHistory()
+		}
+	}()
+}
+
+// flushHistory writes users.json if any history changed since the last write.
+func flushHistory() {
+	accountsMutex.Lock()
+	defer accountsMutex.Unlock()
+	if !historyChanged {
+		return
+	}
+	if err := saveAccounts(); err != nil {
+		log.Println("Failed to save history:", err)
+	}
+}
+
+// recordInteraction adds to the history of the logged in user, or of the
+// anonymous visitor, who gets a cookie the first time. Account history is
+// saved by flushHistory.
+func recordInteraction(w http.ResponseWriter, r *http.Request, kind string, carIDs ...int) {
+	now := time.Now()
+	if username := currentUsername(r); username != "" {
+		accountsMutex.Lock()
+		defer accountsMutex.Unlock()
+		account := accounts.Accounts[username]
+		for _, id := range carIDs {
+			account.History = appendHistory(account.History, interaction{CarID: id, Kind: kind, At: now})
+		}
+		historyChanged = true
+		return
+	}
+
+	id := visitorID(w, r)
+	visitorsMutex.Lock()
+	defer visitorsMutex.Unlock()
+	element, ok := visitors[id]
+	if ok {
+		visitorOrder.MoveToFront(element)
+	} else {
+		if visitorOrder.Len() >= maxVisitors {
+			oldest := visitorOrder.Remove(visitorOrder.Back()).(*visitor)
+			delete(visitors, oldest.id)
+		}
+		element = visitorOrder.PushFront(&visitor{id: id})
+		visitors[id] = element
+	}
+	v := element.Value.(*visitor)
+	for _, id := range carIDs {
+		v.history = appendHistory(v.history, interaction{CarID: id, Kind: kind, At: now})
+	}
+}
+
+// appendHistory adds an event and keeps only the newest maxHistory.
+func appendHistory(history []interaction, event interaction) []interaction {
+	history = append(history, event)
+	if len(history) > maxHistory {
+		history = history[len(history)-maxHistory:]
+	}
+	return history
+}
+
+// visitorIDBytes is how many random bytes a visitor ID is made of.
+const visitorIDBytes = 16
+
+// visitorID returns the anonymous visitor's ID, setting a new cookie if
+// there is none or it holds something visitorID did not issue.
+func visitorID(w http.ResponseWriter, r *http.Request) string {
+	if cookie, err := r.Cookie(visitorCookie); err == nil && validVisitorID(cookie.Value) {
+		return cookie.Value
+	}
+	raw := make([]byte, visitorIDBytes)
+	if _, err := rand.Read(raw); err != nil {
+		panic(err)
+	}
+	id := base64.RawURLEncoding.EncodeToString(raw)
+	http.SetCookie(w, &http.Cookie{
+		Name:     visitorCookie,
+		Value:    id,
+		Path:     "/",
+		MaxAge:   365 * 24 * 60 * 60,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+	return id
+}
+
+// validVisitorID reports whether id looks like an ID made by visitorID.
+func validVisitorID(id string) bool {
+	if len(id) != base64.RawURLEncoding.EncodedLen(visitorIDBytes) {
+		return false
+	}
+	_, err := base64.RawURLEncoding.DecodeString(id)
+	return err == nil
+}
+
+// tasteOf returns how much each car the user has shown interest in counts,
+// and in what way. Current likes always count in full.
+func tasteOf(r *http.Request) (map[int]float64, map[int]string) {
+	var history []interaction
+	var liked []int
+	if username := currentUsername(r); username != "" {
+		accountsMutex.Lock()
+		account := accounts.Accounts[username]
+		history = append(history, account.History...)
+		liked = append(liked, account.LikedCars...)
+		accountsMutex.Unlock()
+	} else if cookie, err := r.Cookie(visitorCookie); err == nil {
+		visitorsMutex.Lock()
+		if element, ok := visitors[cookie.Value]; ok {
+			history = append(history, element.Value.(*visitor).history...)
+		}
+		visitorsMutex.Unlock()
+	}
+
+	weights := map[int]float64{}
+	kinds := map[int]string{}
+	now := time.Now()
+	for _, event := range history {
+		if event.Kind == interactionLike {
+			// Likes are taken from the current list, so unliked cars stop counting
+			continue
+		}
+		decay := math.Pow(0.5, float64(now.Sub(event.At))/float64(historyHalfLife))
+		weights[event.CarID] += interactionWeights[event.Kind] * decay
+		if interactionWeights[event.Kind] > interactionWeights[kinds[event.CarID]] {
+			kinds[event.CarID] = event.Kind
+		}
+	}
+	for _, id := range liked {
+		weights[id] += interactionWeights[interactionLike]
+		kinds[id] = interactionLike
+	}
+	return weights, kinds
+}
+
+// similarity scores how alike two car models are, from 0 to 1, with the
+// reasons that contributed.
+func similarity(a, b CarModel, categories map[int]Category, makers map[int]Manufacturer) (float64, []string) {
+	var score float64
+	var reasons []string
+	if a.CategoryID == b.CategoryID {
+		score += 0.3
+		reasons = append(reasons, "same category ("+categories[a.CategoryID].Name+")")
+	}
+	if a.ManufacturerID == b.ManufacturerID {
+		score += 0.25
+		reasons = append(reasons, "same manufacturer ("+makers[a.ManufacturerID].Name+")")
+	}
+	switch bandA, bandB := a.Specifications.Horsepower/100, b.Specifications.Horsepower/100; {
+	case bandA == bandB:
+		score += 0.2
+		reasons = append(reasons, fmt.Sprintf("similar power (%d-%d hp)", bandA*100, bandA*100+99))
+	case bandA-bandB == 1 || bandB-bandA == 1:
+		score += 0.1
+	}
+	if a.Specifications.Drivetrain != "" && strings.EqualFold(a.Specifications.Drivetrain, b.Specifications.Drivetrain) {
+		score += 0.15
+		reasons = append(reasons, "same drivetrain ("+a.Specifications.Drivetrain+")")
+	}
+	if diff := a.Year - b.Year; diff >= -1 && diff <= 1 {
+		score += 0.1
+		reasons = append(reasons, "similar model year")
+	}
+	return score, reasons
+}
+
+// recommendation is a car model with why it was picked.
+type recommendation struct {
+	CarModel
+	Score       float64 `json:"score"`
+	Explanation string  `json:"explanation"`
+}
+
+var kindPhrases = map[string]string{
+	interactionView:    "viewed",
+	interactionCompare: "compared",
+	interactionLike:    "liked",
+}
+
+// recommend ranks the cars the user has not interacted with by their
+// similarity to the ones they have, weighted by how strong and how recent
+// the interest was.
+func recommend(weights map[int]float64, kinds map[int]string, n int) []recommendation {
+	manufacturers, categoryList, models := snapshot()
+	makers := map[int]Manufacturer{}
+	for _, m := range manufacturers {
+		makers[m.ID] = m
+	}
+	categories := map[int]Category{}
+	for _, c := range categoryList {
+		categories[c.ID] = c
+	}
+	byID := map[int]CarModel{}
+	for _, m := range models {
+		byID[m.ID] = m
+	}
+
+	recs := []recommendation{}
+	if len(weights) == 0 {
+		// Nothing to go on yet, so show the newest models
+		sort.SliceStable(models, func(i, j int) bool { return models[i].Year > models[j].Year })
+		for _, m := range models {
+			if len(recs) == n {
+				break
+			}
+			recs = append(recs, recommendation{CarModel: m, Explanation: "One of the newest models. View or like cars to get personal picks."})
+		}
+		return recs
+	}
+
+	for _, candidate := range models {
+		if _, seen := weights[candidate.ID]; seen {
+			continue
+		}
+		var total, best float64
+		var explanation string
+		for seedID, weight := range weights {
+			seed, ok := byID[seedID]
+			if !ok {
+				continue
+			}
+			sim, reasons := similarity(seed, candidate, categories, makers)
+			total += weight * sim
+			if contribution := weight * sim; contribution > best && len(reasons) > 0 {
+				best = contribution
+				explanation = fmt.Sprintf("Similar to the %s you %s: %s.", seed.Name, kindPhrases[kinds[seedID]], joinReasons(reasons))
+			}
+		}
+		if total > 0 {
+			recs = append(recs, recommendation{CarModel: candidate, Score: float64(int(total*1000+0.5)) / 1000, Explanation: explanation})
+		}
+	}
+	sort.SliceStable(recs, func(i, j int) bool {
+		if recs[i].Score != recs[j].Score {
+			return recs[i].Score > recs[j].Score
+		}
+		return recs[i].ID < recs[j].ID
+	})
+	if len(recs) > n {
+		recs = recs[:n]
+	}
+	return recs
+}
+
+// joinReasons turns ["a", "b", "c"] into "a, b and c".
+func joinReasons(reasons []string) string {
+	if len(reasons) == 1 {
+		return reasons[0]
+	}
+	return strings.Join(reasons[:len(reasons)-1], ", ") + " and " + reasons[len(reasons)-1]
+}
+
+// recommendationCount reads the "n" parameter.
+func recommendationCount(r *http.Request) (int, error) {
+	s := r.URL.Query().Get("n")
+	if s == "" {
+		return defaultRecommendations, nil
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 1 || n > maxRecommendations {
+		return 0, fmt.Errorf("n must be between 1 and %d", maxRecommendations)
+	}
+	return n, nil
+}
@@ -0,0 +1,325 @@
+package main
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Page sizes for /searchCarModels.
+const (
+	defaultSearchLimit = 20
+	maxSearchLimit     = 100
+)
+
+var errBadCursor = errors.New("invalid cursor")
+
+// carQuery is a parsed /searchCarModels request. Empty lists and zero
+// bounds mean no filter.
+type carQuery struct {
+	Name          string
+	Manufacturers []int
+	Categories    []int
+	Countries     []string
+	Transmissions []string
+	Drivetrains   []string
+	YearMin       int
+	YearMax       int
+	HorsepowerMin int
+	HorsepowerMax int
+	// Filters on the parsed specifications
+	DisplacementMin   float64
+	DisplacementMax   float64
+	Cylinders         []int
+	Layouts           []string
+	GearsMin          int
+	GearsMax          int
+	TransmissionTypes []string
+	DriveTypes        []string
+	Sort              []sortKey
+	Limit             int
+	Offset            int
+	// key identifies the filters and sort order, so a cursor cannot be used
+	// with a different query.
+	key string
+}
+
+type sortKey struct {
+	field string
+	desc  bool
+}
+
+// searchResponse is one page of search results.
+type searchResponse struct {
+	Results    []CarModel `json:"results"`
+	Total      int        `json:"total"`
+	Limit      int        `json:"limit"`
+	Offset     int        `json:"offset"`
+	NextCursor string     `json:"nextCursor,omitempty"`
+}
+
+// sortFields compare two car models by one field.
+var sortFields = map[string]func(a, b CarModel, makers map[int]Manufacturer) int{
+	"id":   func(a, b CarModel, _ map[int]Manufacturer) int { return a.ID - b.ID },
+	"year": func(a, b CarModel, _ map[int]Manufacturer) int { return a.Year - b.Year },
+	"horsepower": func(a, b CarModel, _ map[int]Manufacturer) int {
+		return a.Specifications.Horsepower - b.Specifications.Horsepower
+	},
+	"name": func(a, b CarModel, _ map[int]Manufacturer) int {
+		return strings.Compare(strings.ToLower(a.Name), strings.ToLower(b.Name))
+	},
+	"manufacturer": func(a, b CarModel, makers map[int]Manufacturer) int {
+		return strings.Compare(makers[a.ManufacturerID].Name, makers[b.ManufacturerID].Name)
+	},
+	"displacement": func(a, b CarModel, _ map[int]Manufacturer) int {
+		switch da, db := a.Specifications.DisplacementLiters, b.Specifications.DisplacementLiters; {
+		case da < db:
+			return -1
+		case da > db:
+			return 1
+		}
+		return 0
+	},
+	"cylinders": func(a, b CarModel, _ map[int]Manufacturer) int {
+		return a.Specifications.Cylinders - b.Specifications.Cylinders
+	},
+	"gears": func(a, b CarModel, _ map[int]Manufacturer) int {
+		return a.Specifications.Gears - b.Specifications.Gears
+	},
+}
+
+// parseCarQuery reads the search parameters. List parameters may be repeated
+// or comma separated, and "sort" takes fields with an optional "-" for
+// descending order, such as "sort=-horsepower,name".
+func parseCarQuery(v url.Values) (carQuery, error) {
+	q := carQuery{
+		Name:              strings.ToLower(strings.TrimSpace(v.Get("name"))),
+		Countries:         lowerList(v, "country"),
+		Transmissions:     lowerList(v, "transmission"),
+		Drivetrains:       lowerList(v, "drivetrain"),
+		Layouts:           lowerList(v, "layout"),
+		TransmissionTypes: lowerList(v, "transmissionType"),
+		DriveTypes:        lowerList(v, "driveType"),
+		Limit:             defaultSearchLimit,
+	}
+
+	var err error
+	if q.Manufacturers, err = intList(v, "manufacturer"); err != nil {
+		return q, err
+	}
+	if q.Categories, err = intList(v, "category"); err != nil {
+		return q, err
+	}
+	if q.Cylinders, err = intList(v, "cylinders"); err != nil {
+		return q, err
+	}
+	for name, target := range map[string]*int{
+		"yearMin": &q.YearMin, "yearMax": &q.YearMax,
+		"horsepowerMin": &q.HorsepowerMin, "horsepowerMax": &q.HorsepowerMax,
+		"gearsMin": &q.GearsMin, "gearsMax": &q.GearsMax,
+		"limit": &q.Limit, "offset": &q.Offset,
+	} {
+		if s := v.Get(name); s != "" {
+			n, err := strconv.Atoi(s)
+			if err != nil || n < 0 {
+				return q, fmt.Errorf("%s must be a whole number", name)
+			}
+			*target = n
+		}
+	}
+	for name, target := range map[string]*float64{
+		"displacementMin": &q.DisplacementMin, "displacementMax": &q.DisplacementMax,
+	} {
+		if s := v.Get(name); s != "" {
+			n, err := strconv.ParseFloat(s, 64)
+			if err != nil || n < 0 {
+				return q, fmt.Errorf("%s must be a number of liters", name)
+			}
+			*target = n
+		}
+	}
+	if q.Limit < 1 || q.Limit > maxSearchLimit {
+		return q, fmt.Errorf("limit must be between 1 and %d", maxSearchLimit)
+	}
+
+	for _, field := range list(v, "sort") {
+		key := sortKey{field: strings.TrimPrefix(field, "-"), desc: strings.HasPrefix(field, "-")}
+		if _, ok := sortFields[key.field]; !ok {
+			return q, fmt.Errorf("cannot sort by %q", key.field)
+		}
+		q.Sort = append(q.Sort, key)
+	}
+
+	q.key = queryKey(v)
+	if cursor := v.Get("cursor"); cursor != "" {
+		if q.Offset, err = decodeCursor(cursor, q.key); err != nil {
+			return q, err
+		}
+	}
+	return q, nil
+}
+
+// match reports whether a car model passes every filter.
+func (q carQuery) match(m CarModel, maker Manufacturer) bool {
+	spec := m.Specifications
+	return (q.Name == "" || strings.Contains(strings.ToLower(m.Name), q.Name)) &&
+		(len(q.Manufacturers) == 0 || containsInt(q.Manufacturers, m.ManufacturerID)) &&
+		(len(q.Categories) == 0 || containsInt(q.Categories, m.CategoryID)) &&
+		(len(q.Countries) == 0 || containsString(q.Countries, strings.ToLower(maker.Country))) &&
+		(len(q.Transmissions) == 0 || containsPart(q.Transmissions, spec.Transmission)) &&
+		(len(q.Drivetrains) == 0 || containsPart(q.Drivetrains, spec.Drivetrain)) &&
+		(q.YearMin == 0 || m.Year >= q.YearMin) &&
+		(q.YearMax == 0 || m.Year <= q.YearMax) &&
+		(q.HorsepowerMin == 0 || spec.Horsepower >= q.HorsepowerMin) &&
+		(q.HorsepowerMax == 0 || spec.Horsepower <= q.HorsepowerMax) &&
+		(q.DisplacementMin == 0 || spec.DisplacementLiters >= q.DisplacementMin) &&
+		(q.DisplacementMax == 0 || spec.DisplacementLiters <= q.DisplacementMax) &&
+		(len(q.Cylinders) == 0 || containsInt(q.Cylinders, spec.Cylinders)) &&
+		(len(q.Layouts) == 0 || containsString(q.Layouts, strings.ToLower(spec.Layout))) &&
+		(q.GearsMin == 0 || spec.Gears >= q.GearsMin) &&
+		(q.GearsMax == 0 || spec.Gears <= q.GearsMax) &&
+		(len(q.TransmissionTypes) == 0 || containsString(q.TransmissionTypes, strings.ToLower(spec.TransmissionType))) &&
+		(len(q.DriveTypes) == 0 || containsString(q.DriveTypes, strings.ToLower(spec.DriveType)))
+}
+
+// run filters, sorts and pages the catalog.
+func (q carQuery) run(manufacturers []Manufacturer, models []CarModel) searchResponse {
+	makers := make(map[int]Manufacturer, len(manufacturers))
+	for _, m := range manufacturers {
+		makers[m.ID] = m
+	}
+
+	matches := []CarModel{}
+	for _, m := range models {
+		if q.match(m, makers[m.ManufacturerID]) {
+			matches = append(matches, m)
+		}
+	}
+	sort.SliceStable(matches, func(i, j int) bool {
+		for _, key := range append(q.Sort, sortKey{field: "id"}) {
+			c := sortFields[key.field](matches[i], matches[j], makers)
+			if key.desc {
+				c = -c
+			}
+			if c != 0 {
+				return c < 0
+			}
+		}
+		return false
+	})
+
+	resp := searchResponse{Results: []CarModel{}, Total: len(matches), Limit: q.Limit, Offset: q.Offset}
+	if q.Offset < len(matches) {
+		end := q.Offset + q.Limit
+		if end > len(matches) {
+			end = len(matches)
+		}
+		resp.Results = matches[q.Offset:end]
+		if end < len(matches) {
+			resp.NextCursor = encodeCursor(end, q.key)
+		}
+	}
+	return resp
+}
+
+// queryKey hashes every parameter except the paging ones.
+func queryKey(v url.Values) string {
+	var keys []string
+	for k := range v {
+		if k != "limit" && k != "offset" && k != "cursor" {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	h := fnv.New32a()
+	for _, k := range keys {
+		fmt.Fprintf(h, "%s=%s&", k, strings.Join(v[k], ","))
+	}
+	return strconv.FormatUint(uint64(h.Sum32()), 36)
+}
+
+// A cursor holds the offset of the next page and the key of its query.
+func encodeCursor(offset int, key string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.Itoa(offset) + ":" + key))
+}
+
+func decodeCursor(cursor, key string) (int, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, errBadCursor
+	}
+	offsetStr, cursorKey, ok := strings.Cut(string(raw), ":")
+	offset, err := strconv.Atoi(offsetStr)
+	if !ok || err != nil || offset < 0 || cursorKey != key {
+		return 0, errBadCursor
+	}
+	return offset, nil
+}
+
+// list returns every value of a repeated or comma separated parameter.
+func list(v url.Values, name string) []string {
+	var out []string
+	for _, value := range v[name] {
+		for _, part := range strings.Split(value, ",") {
+			if part = strings.TrimSpace(part); part != "" {
+				out = append(out, part)
+			}
+		}
+	}
+	return out
+}
+
+func lowerList(v url.Values, name string) []string {
+	out := list(v, name)
+	for i := range out {
+		out[i] = strings.ToLower(out[i])
+	}
+	return out
+}
+
+func intList(v url.Values, name string) ([]int, error) {
+	var out []int
+	for _, s := range list(v, name) {
+		n, err := strconv.Atoi(s)
+		if err != nil {
+			return nil, fmt.Errorf("%s must be a list of whole numbers", name)
+		}
+		out = append(out, n)
+	}
+	return out, nil
+}
+
+func containsInt(list []int, n int) bool {
+	for _, v := range list {
+		if v == n {
+			return true
+		}
+	}
+	return false
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// containsPart reports whether value contains any of the lower case parts,
+// so "automatic" matches "8-speed Automatic".
+func containsPart(parts []string, value string) bool {
+	value = strings.ToLower(value)
+	for _, p := range parts {
+		if strings.Contains(value, p) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"net/url"
+	"reflect"
+	"testing"
+)
+
+func TestParseCarQuery(t *testing.T) {
+	tests := []struct {
+		query string
+		want  carQuery
+	}{
+		{"", carQuery{Limit: defaultSearchLimit}},
+		{"name=+Civic+", carQuery{Name: "civic", Limit: defaultSearchLimit}},
+		{"manufacturer=1,2&manufacturer=3", carQuery{Manufacturers: []int{1, 2, 3}, Limit: defaultSearchLimit}},
+		{"country=Japan,+Germany&transmission=Manual", carQuery{
+			Countries: []string{"japan", "germany"}, Transmissions: []string{"manual"}, Limit: defaultSearchLimit,
+		}},
+		{"yearMin=2020&yearMax=2023&horsepowerMin=200", carQuery{
+			YearMin: 2020, YearMax: 2023, HorsepowerMin: 200, Limit: defaultSearchLimit,
+		}},
+		{"sort=-horsepower,name", carQuery{
+			Sort: []sortKey{{field: "horsepower", desc: true}, {field: "name"}}, Limit: defaultSearchLimit,
+		}},
+		{"limit=5&offset=10", carQuery{Limit: 5, Offset: 10}},
+		{"displacementMin=1.5&cylinders=4,6&layout=V&gearsMax=8", carQuery{
+			DisplacementMin: 1.5, Cylinders: []int{4, 6}, Layouts: []string{"v"}, GearsMax: 8, Limit: defaultSearchLimit,
+		}},
+		{"transmissionType=Manual&driveType=awd&sort=displacement", carQuery{
+			TransmissionTypes: []string{"manual"}, DriveTypes: []string{"awd"},
+			Sort: []sortKey{{field: "displacement"}}, Limit: defaultSearchLimit,
+		}},
+	}
+	for _, tt := range tests {
+		v, _ := url.ParseQuery(tt.query)
+		got, err := parseCarQuery(v)
+		if err != nil {
+			t.Errorf("parseCarQuery(%q) failed: %v", tt.query, err)
+			continue
+		}
+		got.key = ""
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseCarQuery(%q) = %+v, want %+v", tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestParseCarQueryErrors(t *testing.T) {
+	for _, query := range []string{
+		"manufacturer=honda",
+		"category=1,x",
+		"yearMin=new",
+		"horsepowerMax=-1",
+		"limit=0",
+		"limit=101",
+		"offset=-5",
+		"sort=price",
+		"cursor=not-a-cursor",
+		"cylinders=four",
+		"displacementMin=big",
+		"gearsMin=-1",
+	} {
+		v, _ := url.ParseQuery(query)
+		if _, err := parseCarQuery(v); err == nil {
+			t.Errorf("parseCarQuery(%q) succeeded, want an error", query)
+		}
+	}
+}
+
+func TestCursorRoundTrip(t *testing.T) {
+	var models []CarModel
+	for id := 1; id <= 5; id++ {
+		models = append(models, CarModel{ID: id, Name: "Car", Year: 2020})
+	}
+
+	v := url.Values{"name": {"car"}, "sort": {"-id"}, "limit": {"2"}}
+	var seen []int
+	for page := 0; ; page++ {
+		if page > 3 {
+			t.Fatal("paging did not end")
+		}
+		q, err := parseCarQuery(v)
+		if err != nil {
+			t.Fatalf("page %d: %v", page, err)
+		}
+		resp := q.run(nil, models)
+		for _, m := range resp.Results {
+			seen = append(seen, m.ID)
+		}
+		if resp.NextCursor == "" {
+			break
+		}
+		v.Set("cursor", resp.NextCursor)
+	}
+	if want := []int{5, 4, 3, 2, 1}; !reflect.DeepEqual(seen, want) {
+		t.Errorf("pages gave %v, want %v", seen, want)
+	}
+
+	// A cursor only works with the query it was made for
+	v.Set("name", "other")
+	if _, err := parseCarQuery(v); err != errBadCursor {
+		t.Errorf("cursor with a different query: err = %v, want errBadCursor", err)
+	}
+
+	offset, err := decodeCursor(encodeCursor(40, "key"), "key")
+	if err != nil || offset != 40 {
+		t.Errorf("decodeCursor(encodeCursor(40)) = %d, %v, want 40", offset, err)
+	}
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// ParsedSpecifications holds what can be read out of the free-form
+// Specifications strings. Fields that could not be read are left empty.
+type ParsedSpecifications struct {
+	DisplacementLiters float64 `json:"displacementLiters,omitempty"`
+	Cylinders          int     `json:"cylinders,omitempty"`
+	Layout             string  `json:"layout,omitempty"`
+	Gears              int     `json:"gears,omitempty"`
+	TransmissionType   string  `json:"transmissionType,omitempty"`
+	DriveType          string  `json:"driveType,omitempty"`
+}
+
+// Engine layouts.
+const (
+	layoutInline   = "inline"
+	layoutV        = "V"
+	layoutFlat     = "flat"
+	layoutW        = "W"
+	layoutRotary   = "rotary"
+	layoutElectric = "electric"
+)
+
+// Transmission types.
+const (
+	transmissionManual      = "manual"
+	transmissionAutomatic   = "automatic"
+	transmissionDualClutch  = "dual-clutch"
+	transmissionCVT         = "CVT"
+	transmissionSingleSpeed = "single-speed"
+)
+
+// Drive types.
+const (
+	driveFWD = "FWD"
+	driveRWD = "RWD"
+	driveAWD = "AWD"
+	drive4WD = "4WD"
+)
+
+var (
+	displacementPattern  = regexp.MustCompile(`(?i)(\d+(?:\.\d+)?)\s*(l|liters?|litres?|cc)\b`)
+	cylinderPattern      = regexp.MustCompile(`(?i)\b(inline|straight|flat|boxer|i|v|w)[- ]?(\d{1,2})\b`)
+	cylinderCountPattern = regexp.MustCompile(`(?i)\b(\d{1,2})[- ]cyl(inder)?s?\b`)
+	gearPattern          = regexp.MustCompile(`(?i)\b(\d{1,2})[- ]?(speed|spd)\b`)
+)
+
+// parseSpecifications reads the engine, transmission and drivetrain strings.
+func parseSpecifications(s Specifications) ParsedSpecifications {
+	var p ParsedSpecifications
+	p.DisplacementLiters, p.Cylinders, p.Layout = parseEngine(s.Engine)
+	p.Gears, p.TransmissionType = parseTransmission(s.Transmission)
+	p.DriveType = parseDrivetrain(s.Drivetrain)
+	return p
+}
+
+// parseEngine reads strings like "2.0L Inline-4", "3.5L V6" or "1998cc
+// Boxer 4".
+func parseEngine(engine string) (liters float64, cylinders int, layout string) {
+	if m := displacementPattern.FindStringSubmatch(engine); m != nil {
+		liters, _ = strconv.ParseFloat(m[1], 64)
+		if strings.EqualFold(m[2], "cc") {
+			liters /= 1000
+		}
+		liters = float64(int(liters*10+0.5)) / 10
+	}
+	lower := strings.ToLower(engine)
+	switch {
+	case strings.Contains(lower, "electric"):
+		return liters, 0, layoutElectric
+	case strings.Contains(lower, "rotary"), strings.Contains(lower, "wankel"):
+		return liters, 0, layoutRotary
+	}
+	if m := cylinderPattern.FindStringSubmatch(engine); m != nil {
+		cylinders, _ = strconv.Atoi(m[2])
+		switch strings.ToLower(m[1]) {
+		case "inline", "straight", "i":
+			layout = layoutInline
+		case "flat", "boxer":
+			layout = layoutFlat
+		case "v":
+			layout = layoutV
+		case "w":
+			layout = layoutW
+		}
+	} else if m := cylinderCountPattern.FindStringSubmatch(engine); m != nil {
+		cylinders, _ = strconv.Atoi(m[1])
+	}
+	return liters, cylinders, layout
+}
+
+// parseTransmission reads strings like "8-speed Automatic", "6-speed Manual"
+// or "CVT".
+func parseTransmission(transmission string) (gears int, kind string) {
+	if m := gearPattern.FindStringSubmatch(transmission); m != nil {
+		gears, _ = strconv.Atoi(m[1])
+	}
+	lower := strings.ToLower(transmission)
+	switch {
+	case strings.Contains(lower, "cvt"), strings.Contains(lower, "continuously variable"):
+		return 0, transmissionCVT
+	case strings.Contains(lower, "dual-clutch"), strings.Contains(lower, "dual clutch"),
+		strings.Contains(lower, "dct"), strings.Contains(lower, "dsg"):
+		kind = transmissionDualClutch
+	case strings.Contains(lower, "single-speed"), strings.Contains(lower, "single speed"):
+		return 1, transmissionSingleSpeed
+	case strings.Contains(lower, "manual"):
+		kind = transmissionManual
+	case strings.Contains(lower, "auto"):
+		kind = transmissionAutomatic
+	}
+	return gears, kind
+}
+
+// parseDrivetrain reads strings like "Rear-Wheel Drive" or "AWD".
+func parseDrivetrain(drivetrain string) string {
+	lower := strings.ToLower(drivetrain)
+	switch {
+	case strings.Contains(lower, "front"), strings.Contains(lower, "fwd"):
+		return driveFWD
+	case strings.Contains(lower, "rear"), strings.Contains(lower, "rwd"):
+		return driveRWD
+	case strings.Contains(lower, "all"), strings.Contains(lower, "awd"):
+		return driveAWD
+	case strings.Contains(lower, "four"), strings.Contains(lower, "4wd"), strings.Contains(lower, "4x4"):
+		return drive4WD
+	}
+	return ""
+}
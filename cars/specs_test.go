@@ -0,0 +1,76 @@
+package main
+
+import "testing"
+
+func TestParseEngine(t *testing.T) {
+	tests := []struct {
+		engine    string
+		liters    float64
+		cylinders int
+		layout    string
+	}{
+		{"2.0L Inline-4", 2.0, 4, layoutInline},
+		{"3.5L V6", 3.5, 6, layoutV},
+		{"1998cc Boxer 4", 2.0, 4, layoutFlat},
+		{"6.0 liter W12", 6.0, 12, layoutW},
+		{"2.5L straight 6", 2.5, 6, layoutInline},
+		{"1.6L 4-cylinder", 1.6, 4, ""},
+		{"1.3L Rotary", 1.3, 0, layoutRotary},
+		{"Electric Motor", 0, 0, layoutElectric},
+		{"Dual Electric Motors", 0, 0, layoutElectric},
+		{"", 0, 0, ""},
+		{"Turbocharged", 0, 0, ""},
+	}
+	for _, tt := range tests {
+		liters, cylinders, layout := parseEngine(tt.engine)
+		if liters != tt.liters || cylinders != tt.cylinders || layout != tt.layout {
+			t.Errorf("parseEngine(%q) = %v, %d, %q, want %v, %d, %q",
+				tt.engine, liters, cylinders, layout, tt.liters, tt.cylinders, tt.layout)
+		}
+	}
+}
+
+func TestParseTransmission(t *testing.T) {
+	tests := []struct {
+		transmission string
+		gears        int
+		kind         string
+	}{
+		{"8-speed Automatic", 8, transmissionAutomatic},
+		{"6-speed Manual", 6, transmissionManual},
+		{"7-speed Dual-Clutch", 7, transmissionDualClutch},
+		{"6 spd DSG", 6, transmissionDualClutch},
+		{"CVT", 0, transmissionCVT},
+		{"Continuously Variable", 0, transmissionCVT},
+		{"Single-Speed", 1, transmissionSingleSpeed},
+		{"10-speed", 10, ""},
+		{"", 0, ""},
+	}
+	for _, tt := range tests {
+		gears, kind := parseTransmission(tt.transmission)
+		if gears != tt.gears || kind != tt.kind {
+			t.Errorf("parseTransmission(%q) = %d, %q, want %d, %q", tt.transmission, gears, kind, tt.gears, tt.kind)
+		}
+	}
+}
+
+func TestParseDrivetrain(t *testing.T) {
+	tests := []struct {
+		drivetrain, want string
+	}{
+		{"Front-Wheel Drive", driveFWD},
+		{"Rear-Wheel Drive", driveRWD},
+		{"All-Wheel Drive", driveAWD},
+		{"Four-Wheel Drive", drive4WD},
+		{"AWD", driveAWD},
+		{"4x4", drive4WD},
+		{"rwd", driveRWD},
+		{"", ""},
+		{"Tracks", ""},
+	}
+	for _, tt := range tests {
+		if got := parseDrivetrain(tt.drivetrain); got != tt.want {
+			t.Errorf("parseDrivetrain(%q) = %q, want %q", tt.drivetrain, got, tt.want)
+		}
+	}
+}
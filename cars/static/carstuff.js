@@ -72,7 +72,7 @@ function displayCars(cars) {
     const carDiv = document.createElement('div');
     carDiv.className = 'container';
     carDiv.innerHTML = `
-      <img src="${car.image}" alt="${car.name}" class="image">
+      <img src="${car.thumbnail || car.image}" alt="${car.name}" class="image">
       <div class="middle">
         <div class="button" onclick="showCarDetail(${car.id})">${car.name}</div>
       </div>
@@ -1,13 +1,6 @@
-// js code that shows liked cars and keeps them in memory
+// js code that shows liked cars, which are kept in the user's account
 let carData = [];
-let likedCars = JSON.parse(localStorage.getItem('likedCars')) || [];
-const userID = localStorage.getItem('userID') || generateUserID();
-
-function generateUserID() {
-  const newUserID = 'user-' + Math.random().toString(36).substring(2, 15);
-  localStorage.setItem('userID', newUserID);
-  return newUserID;
-}
+let likedCars = [];
 
 document.addEventListener('DOMContentLoaded', () => {
   fetchLikedCars();
@@ -26,12 +19,8 @@ function fetchCarModels() {
 }
 
 function fetchLikedCars() {
-  fetch('/likedCars', {
-    headers: {
-      'User-ID': userID
-    }
-  })
-    .then(response => response.json())
+  fetch('/likedCars')
+    .then(response => response.ok ? response.json() : [])
     .then(data => {
       likedCars = data.map(car => car.id);
       localStorage.setItem('likedCars', JSON.stringify(likedCars));
@@ -48,7 +37,7 @@ function displayCars(cars) {
     carDiv.className = 'container';
     const isLiked = likedCars.includes(car.id);
     carDiv.innerHTML = `
-      <img src="/img/${car.image}" alt="${car.name}" class="image">
+      <img src="${car.thumbnail || car.image}" alt="${car.name}" class="image">
       <div class="middle">
         <div class="button" onclick="showCarDetail(${car.id})">${car.name}</div>
         <div class="like-button" id="like-icon-${car.id}" onclick="toggleLike(${car.id})">
@@ -70,26 +59,26 @@ function updateLikeIcons() {
 }
 
 function toggleLike(carId) {
-  const index = likedCars.indexOf(carId);
-  const isLiked = index > -1;
-
-  if (isLiked) {
-    likedCars.splice(index, 1);
-  } else {
-    likedCars.push(carId);
-  }
-
-  localStorage.setItem('likedCars', JSON.stringify(likedCars));
-  updateLikeIcons();
-
+  const liked = !likedCars.includes(carId);
   fetch(`/likeCar?car_model_id=${carId}`, {
-    method: 'POST',
-    headers: {
-      'User-ID': userID
-    }
+    method: liked ? 'PUT' : 'DELETE'
   }).then(response => {
+    if (response.status === 401) {
+      window.location.href = '/login.html?next=/';
+      return;
+    }
     if (!response.ok) {
       console.error('Failed to update liked car status on the server');
+      return;
+    }
+    likedCars = likedCars.filter(id => id !== carId);
+    if (liked) {
+      likedCars.push(carId);
+    }
+    localStorage.setItem('likedCars', JSON.stringify(likedCars));
+    const likeIcon = document.getElementById(`like-icon-${carId}`);
+    if (likeIcon) {
+      likeIcon.innerHTML = `<span>${liked ? '♥' : '♡'}</span>`;
     }
   }).catch(error => console.error('Error updating liked car status:', error));
 }
@@ -19,7 +19,8 @@ document.addEventListener("DOMContentLoaded", function() {
         carElement.className = 'car-card';
         carElement.innerHTML = `
           <h3>${car.name}</h3>
-          <img src="${car.image}" alt="${car.name}" class="car-image">
+          <img src="${car.thumbnail || car.image}" alt="${car.name}" class="car-image">
+          <p>${car.explanation}</p>
         `;
         carElement.addEventListener('click', function() {
           window.location.href = `/details.html?id=${car.id}`;
@@ -3,35 +3,55 @@ const searchInput = document.querySelector("[data-search]");
 const suggestionsBox = document.getElementById('suggestions');
 
 searchInput.addEventListener('input', (e) => {
-  const value = e.target.value.toLowerCase();
-  suggestionsBox.innerHTML = '';
-  if (value) {
-    const suggestions = carData.filter(car => car.name.toLowerCase().includes(value));
-    if (suggestions.length > 0) {
-      suggestionsBox.classList.add('has-suggestions');
-    } else {
-      suggestionsBox.classList.remove('has-suggestions');
-    }
-    suggestions.forEach(car => {
-      const suggestionDiv = document.createElement('div');
-      suggestionDiv.className = 'suggestion';
-      suggestionDiv.textContent = car.name;
-      suggestionDiv.addEventListener('click', () => {
-        showCarDetail(car.id);
-      });
-      suggestionsBox.appendChild(suggestionDiv);
-    });
-  } else {
+  const value = e.target.value.trim();
+  if (!value) {
+    suggestionsBox.innerHTML = '';
     suggestionsBox.classList.remove('has-suggestions');
+    return;
   }
+  fetch(`/search?mode=autocomplete&q=${encodeURIComponent(value)}`)
+    .then(response => response.json())
+    .then(suggestions => {
+      // Ignore answers for text that has changed since
+      if (searchInput.value.trim() !== value) {
+        return;
+      }
+      suggestionsBox.innerHTML = '';
+      suggestionsBox.classList.toggle('has-suggestions', suggestions.length > 0);
+      suggestions.forEach(suggestion => {
+        const suggestionDiv = document.createElement('div');
+        suggestionDiv.className = 'suggestion';
+        suggestionDiv.textContent = suggestion.text;
+        suggestionDiv.addEventListener('click', () => {
+          if (suggestion.type === 'carModel') {
+            showCarDetail(suggestion.id);
+          } else {
+            searchInput.value = suggestion.text;
+            showSearchResults(suggestion.text);
+          }
+        });
+        suggestionsBox.appendChild(suggestionDiv);
+      });
+    })
+    .catch(error => console.error('Error fetching suggestions:', error));
 });
 
 searchInput.addEventListener('keypress', (e) => {
   if (e.key === 'Enter') {
-    const value = searchInput.value.toLowerCase();
-    const car = carData.find(car => car.name.toLowerCase().includes(value));
-    if (car) {
-      showCarDetail(car.id);
-    }
+    showSearchResults(searchInput.value);
   }
 });
+
+// showSearchResults lists the cars matching the query, best match first
+function showSearchResults(query) {
+  suggestionsBox.innerHTML = '';
+  suggestionsBox.classList.remove('has-suggestions');
+  if (!query.trim()) {
+    displayCars(carData);
+    return;
+  }
+  fetch(`/search?q=${encodeURIComponent(query)}`)
+    .then(response => response.json())
+    .then(results => displayCars(results))
+    .catch(error => console.error('Error searching cars:', error));
+}
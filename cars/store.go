@@ -0,0 +1,156 @@
+package main
+
+import (
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+)
+
+// seedData is the catalog the store starts with when there is no data file.
+//
+//go:embed api/data.json
+var seedData []byte
+
+// defaultDataFile is where the catalog is saved unless CARS_DATA_FILE is set.
+const defaultDataFile = "cars.json"
+
+var dataFile = defaultDataFile
+
+// catalogVersion goes up whenever the catalog changes, so indexes built from
+// it know when to rebuild. It is guarded by dataMutex.
+var catalogVersion int
+
+// catalog is the part of Data that is saved to disk.
+type catalog struct {
+	Manufacturers []Manufacturer `json:"manufacturers"`
+	Categories    []Category     `json:"categories"`
+	CarModels     []CarModel     `json:"carModels"`
+}
+
+// apply copies the catalog into data. The caller must hold dataMutex.
+func (c catalog) apply() {
+	c.prepare()
+	data.Manufacturers = c.Manufacturers
+	data.Categories = c.Categories
+	data.CarModels = c.CarModels
+	catalogVersion++
+}
+
+// prepare fills in image URLs and the parsed specifications of loaded car
+// models.
+func (c catalog) prepare() {
+	for i := range c.CarModels {
+		c.CarModels[i].Image = imagePath(c.CarModels[i].Image)
+		spec := &c.CarModels[i].Specifications
+		spec.ParsedSpecifications = parseSpecifications(*spec)
+	}
+}
+
+// imagePath turns a bare file name, as used in api/data.json, into the URL
+// the image is served from. Models without an image get the placeholder.
+func imagePath(image string) string {
+	switch {
+	case image == "":
+		return placeholderImage
+	case strings.Contains(image, "/"):
+		return image
+	}
+	return imagesURL + image
+}
+
+// loadData fills data from the data file. On the first run the catalog is
+// imported from CARS_IMPORT_URL if set, or seeded from api/data.json.
+func loadData() {
+	if f := os.Getenv("CARS_DATA_FILE"); f != "" {
+		dataFile = f
+	}
+
+	content, err := os.ReadFile(dataFile)
+	switch {
+	case err == nil:
+		var saved catalog
+		if err := json.Unmarshal(content, &saved); err != nil {
+			log.Fatalf("Error reading %s: %v", dataFile, err)
+		}
+		dataMutex.Lock()
+		saved.apply()
+		dataMutex.Unlock()
+		log.Printf("Loaded %d car models from %s", len(saved.CarModels), dataFile)
+
+	case errors.Is(err, os.ErrNotExist):
+		if url := os.Getenv("CARS_IMPORT_URL"); url != "" {
+			if err := importFromAPI(url); err != nil {
+				log.Fatalf("Error importing data from %s: %v", url, err)
+			}
+			log.Printf("Imported data from %s into %s", url, dataFile)
+			return
+		}
+		if err := seed(); err != nil {
+			log.Fatalf("Error seeding data: %v", err)
+		}
+		log.Printf("Seeded %s from api/data.json", dataFile)
+
+	default:
+		log.Fatalf("Error reading %s: %v", dataFile, err)
+	}
+}
+
+// seed replaces the catalog with the bundled api/data.json and saves it.
+func seed() error {
+	var seeded catalog
+	if err := json.Unmarshal(seedData, &seeded); err != nil {
+		return fmt.Errorf("bad seed data: %w", err)
+	}
+	dataMutex.Lock()
+	defer dataMutex.Unlock()
+	seeded.apply()
+	return saveData()
+}
+
+// current returns the catalog held in data. Its slices are shared with data,
+// so they must be copied before they are changed. The caller must hold
+// dataMutex.
+func current() catalog {
+	return catalog{
+		Manufacturers: data.Manufacturers,
+		Categories:    data.Categories,
+		CarModels:     data.CarModels,
+	}
+}
+
+// commit saves c and only then makes it the catalog in data, so a failed
+// save leaves the catalog as it was. The caller must hold dataMutex.
+func commit(c catalog) error {
+	if err := writeCatalog(c); err != nil {
+		return err
+	}
+	data.Manufacturers = c.Manufacturers
+	data.Categories = c.Categories
+	data.CarModels = c.CarModels
+	catalogVersion++
+	return nil
+}
+
+// saveData writes the catalog in data to the data file. The caller must hold
+// dataMutex.
+func saveData() error {
+	return writeCatalog(current())
+}
+
+// writeCatalog writes c to the data file. It writes to a temporary file first
+// so a crash never leaves a half-written file behind.
+func writeCatalog(c catalog) error {
+	content, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := dataFile + ".tmp"
+	if err := os.WriteFile(tmp, content, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, dataFile)
+}